@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+)
+
+// userNames caches the names of the comment authors and todo owners across
+// the documents of a download. Looking up a name needs a permission of the
+// contact API, so the open ids are kept once the permission is found missing.
+type userNames struct {
+	mu     sync.Mutex
+	names  map[string]string
+	denied bool
+}
+
+var dlUserNames = userNames{}
+
+// lookup returns the names of the users by open id, looking up the users
+// not seen before
+func (u *userNames) lookup(ctx context.Context, client core.DocSource, userIDs []string) map[string]string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.names == nil {
+		u.names = make(map[string]string)
+	}
+	names := make(map[string]string)
+	for _, userID := range userIDs {
+		name, ok := u.names[userID]
+		if !ok && !u.denied {
+			err := dlPool.Do(func() (err error) {
+				name, err = client.GetUserName(ctx, userID)
+				return err
+			})
+			if errors.Is(err, core.ErrPermissionDenied) {
+				fmt.Printf("Failed to get the names of the comment authors and todo owners, keeping their open ids: %v\n", err)
+				u.denied = true
+			} else if err != nil {
+				fmt.Printf("Failed to get the name of %s: %v\n", userID, err)
+			}
+			u.names[userID] = name
+		}
+		names[userID] = name
+	}
+	return names
+}
@@ -11,6 +11,7 @@ import (
 type ConfigOpts struct {
 	appId     string
 	appSecret string
+	apiDomain string
 }
 
 var configOpts = ConfigOpts{}
@@ -24,6 +25,7 @@ func handleConfigCommand() error {
 	fmt.Println("Configuration file on: " + configPath)
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		config := core.NewConfig(configOpts.appId, configOpts.appSecret)
+		config.Feishu.ApiDomain = configOpts.apiDomain
 		if err = config.WriteConfig2File(configPath); err != nil {
 			return err
 		}
@@ -39,7 +41,10 @@ func handleConfigCommand() error {
 		if configOpts.appSecret != "" {
 			config.Feishu.AppSecret = configOpts.appSecret
 		}
-		if configOpts.appId != "" || configOpts.appSecret != "" {
+		if configOpts.apiDomain != "" {
+			config.Feishu.ApiDomain = configOpts.apiDomain
+		}
+		if configOpts.appId != "" || configOpts.appSecret != "" || configOpts.apiDomain != "" {
 			if err = config.WriteConfig2File(configPath); err != nil {
 				return err
 			}
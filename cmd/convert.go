@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type ConvertOpts struct {
+	outputDir       string
+	titleAsFilename bool
+	useHTMLTags     bool
+	mathDialect     string
+	toc             bool
+	slugStyle       string
+	commentStyle    string
+	codeLanguageMap cli.StringSlice
+}
+
+var convertOpts = ConvertOpts{}
+
+// convertDump renders the json dumped by `download --dump` to markdown
+// and returns the path of the markdown file
+func convertDump(dumpPath string, config core.OutputConfig, outputDir string) (string, error) {
+	dump, err := core.ReadDocxDump(dumpPath)
+	if err != nil {
+		return "", err
+	}
+
+	parser := core.NewParser(config)
+	parser.SetComments(dump.Comments)
+	parser.SetUserNames(dump.UserNames)
+	parser.SetTasks(dump.Tasks)
+	result := formatMarkdown(parser.ParseDocxContent(dump.Document, dump.Blocks))
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return "", err
+	}
+	mdName := fmt.Sprintf("%s.md", dump.Document.DocumentID)
+	if config.TitleAsFilename {
+		mdName = fmt.Sprintf("%s.md", utils.SanitizeFileName(dump.Document.Title))
+	}
+	outputPath := filepath.Join(outputDir, mdName)
+	if err = os.WriteFile(outputPath, []byte(result), 0o644); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// handleConvertCommand converts the dumps with the output options of the
+// config file, if any, overridden by the flags set by the user
+func handleConvertCommand(dumpPaths []string, isSet func(name string) bool) error {
+	config := core.NewConfig("", "")
+	configPath, err := core.GetConfigFilePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		if config, err = core.ReadConfigFromFile(configPath); err != nil {
+			return err
+		}
+	}
+
+	output := config.Output
+	// the images are not part of the dump
+	output.SkipImgDownload = true
+	if isSet("title-as-filename") {
+		output.TitleAsFilename = convertOpts.titleAsFilename
+	}
+	if isSet("use-html-tags") {
+		output.UseHTMLTags = convertOpts.useHTMLTags
+	}
+	if isSet("math-dialect") {
+		output.MathDialect = convertOpts.mathDialect
+	}
+	if isSet("toc") {
+		output.TOC = convertOpts.toc
+	}
+	if isSet("slug-style") {
+		output.SlugStyle = convertOpts.slugStyle
+	}
+	if isSet("comment-style") {
+		output.CommentStyle = convertOpts.commentStyle
+	}
+	if isSet("code-language-map") {
+		// the flags add to the code_language_map of the config
+		codeLanguageMap := make(map[string]string)
+		for key, lang := range output.CodeLanguageMap {
+			codeLanguageMap[key] = lang
+		}
+		for _, mapping := range convertOpts.codeLanguageMap.Value() {
+			key, lang, ok := strings.Cut(mapping, "=")
+			if !ok {
+				return fmt.Errorf("invalid code language mapping %q, expected name=lang", mapping)
+			}
+			codeLanguageMap[key] = lang
+		}
+		output.CodeLanguageMap = codeLanguageMap
+	}
+	if err := output.Validate(); err != nil {
+		return err
+	}
+
+	for _, dumpPath := range dumpPaths {
+		outputPath, err := convertDump(dumpPath, output, convertOpts.outputDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Converted %s to %s\n", dumpPath, outputPath)
+	}
+	return nil
+}
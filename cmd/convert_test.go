@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func TestConvertDump(t *testing.T) {
+	outputDir := t.TempDir()
+	config := core.NewConfig("", "").Output
+
+	outputPath, err := convertDump(
+		filepath.Join(utils.RootDir(), "testdata", "testdocx.1.json"), config, outputDir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "doxcnXhd93zqoLnmVPGIPTy7AFe.md"), outputPath)
+
+	markdown, err := os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	expected, err := os.ReadFile(filepath.Join(utils.RootDir(), "testdata", "testdocx.1.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(markdown))
+
+	config.TitleAsFilename = true
+	config.TOC = true
+	outputPath, err = convertDump(
+		filepath.Join(utils.RootDir(), "testdata", "fakefeishu", "docx", "doxcnFakeFaq0000000000001.json"),
+		config, outputDir,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "FAQ.md"), outputPath)
+
+	_, err = convertDump(filepath.Join(outputDir, "missing.json"), config, outputDir)
+	assert.Error(t, err)
+}
+
+func TestHandleConvertCommand(t *testing.T) {
+	// no config file
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	outputDir := t.TempDir()
+	convertOpts = ConvertOpts{outputDir: outputDir}
+
+	dump, err := core.ReadDocxDump(
+		filepath.Join(utils.RootDir(), "testdata", "fakefeishu", "docx", "doxcnFakeFaq0000000000001.json"))
+	assert.NoError(t, err)
+	comment := &core.DocxComment{IsWhole: true}
+	comment.UserID = "ou_alice"
+	comment.ReplyList = &lark.GetDriveCommentListRespItemReplyList{
+		Replies: []*lark.GetDriveCommentListRespItemReplyListReply{{
+			UserID: "ou_alice",
+			Content: &lark.GetDriveCommentListRespItemReplyListReplyContent{
+				Elements: []*lark.GetDriveCommentListRespItemReplyListReplyContentElement{
+					{Type: "text_run", TextRun: &lark.GetDriveCommentListRespItemReplyListReplyContentElementTextRun{Text: "Clear"}},
+				},
+			},
+		}},
+	}
+	dump.Comments = []*core.DocxComment{comment}
+	dump.UserNames = map[string]string{"ou_alice": "Alice"}
+	dumpPath := filepath.Join(t.TempDir(), "faq.json")
+	assert.NoError(t, os.WriteFile(dumpPath, []byte(utils.PrettyPrint(dump)), 0o644))
+
+	set := map[string]bool{"comment-style": true}
+	isSet := func(name string) bool { return set[name] }
+	convertOpts.commentStyle = core.CommentStyleAppendix
+	assert.NoError(t, handleConvertCommand([]string{dumpPath}, isSet))
+	markdown, err := os.ReadFile(filepath.Join(outputDir, dump.Document.DocumentID+".md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(markdown), "- **Alice** ")
+
+	convertOpts.commentStyle = "inline"
+	assert.ErrorContains(t, handleConvertCommand([]string{dumpPath}, isSet), "comment_style")
+
+	set = map[string]bool{"code-language-map": true}
+	convertOpts.codeLanguageMap = *cli.NewStringSlice("shell")
+	assert.ErrorContains(t, handleConvertCommand([]string{dumpPath}, isSet), "name=lang")
+}
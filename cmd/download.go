@@ -13,33 +13,88 @@ import (
 	"github.com/Wsine/feishu2md/utils"
 	"github.com/chyroc/lark"
 	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
 )
 
 type DownloadOpts struct {
-	outputDir string
-	dump      bool
-	batch     bool
-	wiki      bool
+	outputDir   string
+	dump        bool
+	batch       bool
+	wiki        bool
+	recursive   bool
+	tasksIndex  bool
+	rateLimit   float64
+	rateBurst   int
+	workers     int
+	noCache     bool
+	wikiLayout  string
+	sheetFormat string
+	bitables    bool
+	files       bool
+	shortcuts   bool
+	maxDepth    int
+	includes    cli.StringSlice
+	excludes    cli.StringSlice
+	modified    string
+	owner       string
+	pathTmpl    string
+	dryRun      bool
+	json        bool
+}
+
+// The layouts of a wiki node with content and children
+const (
+	WikiLayoutSibling = "sibling" // Title.md next to Title/
+	WikiLayoutIndex   = "index"   // Title/index.md
+	WikiLayoutHugo    = "_index"  // Title/_index.md
+	WikiLayoutReadme  = "readme"  // Title/README.md
+)
+
+var wikiLayoutFileNames = map[string]string{
+	WikiLayoutIndex:  "index.md",
+	WikiLayoutHugo:   "_index.md",
+	WikiLayoutReadme: "README.md",
 }
 
 var dlOpts = DownloadOpts{}
 var dlConfig core.Config
 
-func downloadDocument(ctx context.Context, client *core.Client, url string, opts *DownloadOpts) error {
+// formatMarkdown formats the markdown rendered by the parser
+func formatMarkdown(markdown string) string {
+	engine := lute.New(func(l *lute.Lute) {
+		l.RenderOptions.AutoSpace = true
+	})
+	return engine.FormatStr("md", markdown)
+}
+
+func downloadDocument(ctx context.Context, client core.DocSource, url string, opts *DownloadOpts, item *walkItem) (err error) {
 	// Validate the url to download
 	docType, docToken, err := utils.ValidateDocumentURL(url)
 	if err != nil {
 		return err
 	}
-	fmt.Println("Captured document token:", docToken)
+	if dlPlan == nil {
+		fmt.Println("Captured document token:", docToken)
+	}
+
+	// Record the document into the manifest of a batch or wiki download
+	entry := &manifestEntry{URL: url, NodePath: item.nodePath.String()}
+	defer func() {
+		if err != nil {
+			dlManifest.fail(docToken, entry, err)
+		}
+	}()
 
 	// for a wiki page, we need to renew docType and docToken first
 	if docType == "wiki" {
-		node, err := client.GetWikiNodeInfo(ctx, docToken)
+		var node *lark.GetWikiNodeRespNode
+		err := dlPool.Do(func() (err error) {
+			node, err = client.GetWikiNodeInfo(ctx, docToken)
+			return err
+		})
 		if err != nil {
-			err = fmt.Errorf("GetWikiNodeInfo err: %v for %v", err, url)
+			return fmt.Errorf("GetWikiNodeInfo err: %w for %v", err, url)
 		}
-		utils.CheckErr(err)
 		docType = node.ObjType
 		docToken = node.ObjToken
 	}
@@ -49,51 +104,122 @@ func downloadDocument(ctx context.Context, client *core.Client, url string, opts
 				`Please refer to the Readme/Release for v1_support.`)
 	}
 
+	// A dry run only plans the document by its title
+	if dlPlan != nil {
+		var docx *lark.DocxDocument
+		err = dlPool.Do(func() (err error) {
+			docx, err = client.GetDocxDocument(ctx, docToken)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("GetDocxDocument err: %w for %v", err, url)
+		}
+		outputPath, err := item.documentPath(docToken, docx.Title)
+		if err != nil {
+			return err
+		}
+		dlPlan.add(&planItem{Title: docx.Title, Type: docType, Token: docToken,
+			NodePath: item.nodePath.String(), Path: outputPath})
+		return nil
+	}
+
+	// Skip the documents unchanged since the last sync
+	if dlManifest.synced(docToken) {
+		var docx *lark.DocxDocument
+		err = dlPool.Do(func() (err error) {
+			docx, err = client.GetDocxDocument(ctx, docToken)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("GetDocxDocument err: %w for %v", err, url)
+		}
+		entry.Title, entry.RevisionID = docx.Title, docx.RevisionID
+		outputPath, err := item.documentPath(docToken, docx.Title)
+		if err != nil {
+			return err
+		}
+		if ok, err := dlManifest.reuse(docToken, entry, outputPath); ok || err != nil {
+			return err
+		}
+	}
+
 	// Process the download
-	docx, blocks, err := client.GetDocxContent(ctx, docToken)
-	utils.CheckErr(err)
+	var docx *lark.DocxDocument
+	var blocks []*lark.DocxBlock
+	err = dlPool.Do(func() (err error) {
+		docx, blocks, err = client.GetDocxContent(ctx, docToken)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("GetDocxContent err: %w for %v", err, url)
+	}
 
 	parser := core.NewParser(dlConfig.Output)
+	tasks := getDocxTasks(ctx, client, docToken, blocks)
+	parser.SetTasks(tasks)
+	var comments []*core.DocxComment
+	if dlConfig.Output.CommentStyle != "" {
+		err := dlPool.Do(func() (err error) {
+			comments, err = client.GetDocxComments(ctx, docToken)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		parser.SetComments(comments)
+	}
+	userIDs := append(core.CommentUserIDs(comments), core.TodoUserIDs(blocks, tasks)...)
+	var userNames map[string]string
+	if len(userIDs) > 0 {
+		userNames = dlUserNames.lookup(ctx, client, userIDs)
+		parser.SetUserNames(userNames)
+	}
 
 	title := docx.Title
+	entry.Title, entry.RevisionID = title, docx.RevisionID
 	markdown := parser.ParseDocxContent(docx, blocks)
+	if len(parser.HeadingSlugs) > 0 {
+		entry.Anchors = parser.HeadingSlugs
+	}
+	outputPath, err := item.documentPath(docToken, title)
+	if err != nil {
+		return err
+	}
+	outputDir := filepath.Dir(outputPath)
 
+	var localLinks map[string]string
 	if !dlConfig.Output.SkipImgDownload {
+		localLinks, err = downloadImages(
+			ctx, client, parser.ImgTokens, filepath.Join(outputDir, dlConfig.Output.ImageDir),
+		)
+		if err != nil {
+			return err
+		}
 		for _, imgToken := range parser.ImgTokens {
-			localLink, err := client.DownloadImage(
-				ctx, imgToken, filepath.Join(opts.outputDir, dlConfig.Output.ImageDir),
-			)
-			if err != nil {
-				return err
-			}
-			markdown = strings.Replace(markdown, imgToken, localLink, 1)
+			markdown = strings.Replace(markdown, imgToken, localLinks[imgToken], 1)
 		}
 	}
 
 	// Format the markdown document
-	engine := lute.New(func(l *lute.Lute) {
-		l.RenderOptions.AutoSpace = true
-	})
-	result := engine.FormatStr("md", markdown)
+	result := formatMarkdown(markdown)
 
 	// Handle the output directory and name
-	if _, err := os.Stat(opts.outputDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
 			return err
 		}
 	}
 
 	if dlOpts.dump {
 		jsonName := fmt.Sprintf("%s.json", docToken)
-		outputPath := filepath.Join(opts.outputDir, jsonName)
-		data := struct {
-			Document *lark.DocxDocument `json:"document"`
-			Blocks   []*lark.DocxBlock  `json:"blocks"`
-		}{
-			Document: docx,
-			Blocks:   blocks,
-		}
-		pdata := utils.PrettyPrint(data)
+		outputPath := filepath.Join(outputDir, jsonName)
+		pdata := utils.PrettyPrint(core.DocxDump{
+			Document:  docx,
+			Blocks:    blocks,
+			Comments:  comments,
+			UserNames: userNames,
+			Tasks:     tasks,
+		})
 
 		if err = os.WriteFile(outputPath, []byte(pdata), 0o644); err != nil {
 			return err
@@ -102,135 +228,393 @@ func downloadDocument(ctx context.Context, client *core.Client, url string, opts
 	}
 
 	// Write to markdown file
-	mdName := fmt.Sprintf("%s.md", docToken)
-	if dlConfig.Output.TitleAsFilename {
-		mdName = fmt.Sprintf("%s.md", utils.SanitizeFileName(title))
-	}
-	outputPath := filepath.Join(opts.outputDir, mdName)
 	if err = os.WriteFile(outputPath, []byte(result), 0o644); err != nil {
 		return err
 	}
 	fmt.Printf("Downloaded markdown file to %s\n", outputPath)
 
+	if dlManifest != nil {
+		if err = dlManifest.add(docToken, entry, outputPath, localLinks); err != nil {
+			return err
+		}
+	}
+
+	if opts.tasksIndex {
+		dlTasks.add(title, outputPath, parser.Todos)
+	}
+
 	return nil
 }
 
-func downloadDocuments(ctx context.Context, client *core.Client, url string) error {
+// documentPath returns the path of the markdown file of a document, as
+// planned by a batch or wiki walk, or else named after its title or token.
+// A document renamed since the walk listed it is planned again.
+func (item *walkItem) documentPath(docToken, title string) (string, error) {
+	if item.pathData == nil {
+		return item.objectPath(&pathData{Title: title, Token: docToken, Type: "docx"})
+	}
+	if item.pathData.Title == title {
+		return item.outputPath, nil
+	}
+	item.pathClaims.release(item.outputPath)
+	item.pathData.Title = title
+	var err error
+	item.outputPath, err = item.objectPath(&pathData{Title: title, Token: docToken, Type: "docx",
+		Created: item.pathData.Created, Modified: item.pathData.Modified})
+	return item.outputPath, err
+}
+
+// downloadImages concurrently downloads the images into imgDir and returns
+// their local links by token
+func downloadImages(ctx context.Context, client core.DocSource, imgTokens []string, imgDir string) (map[string]string, error) {
+	localLinks := make(map[string]string)
+	mu := sync.Mutex{}
+	errChan := make(chan error, len(imgTokens))
+	wg := sync.WaitGroup{}
+	for _, imgToken := range imgTokens {
+		// the goroutines of the images before write the map meanwhile
+		mu.Lock()
+		if _, ok := localLinks[imgToken]; ok {
+			mu.Unlock()
+			continue
+		}
+		localLinks[imgToken] = imgToken
+		localLink, reused := dlManifest.image(imgToken)
+		if reused {
+			localLinks[imgToken] = localLink
+		}
+		mu.Unlock()
+		if reused {
+			continue
+		}
+		wg.Add(1)
+		go func(imgToken string) {
+			defer wg.Done()
+			err := dlPool.Do(func() error {
+				localLink, err := client.DownloadImage(ctx, imgToken, imgDir)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				localLinks[imgToken] = localLink
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				errChan <- err
+			}
+		}(imgToken)
+	}
+	wg.Wait()
+	close(errChan)
+	for err := range errChan {
+		return nil, err
+	}
+	return localLinks, nil
+}
+
+func downloadDocuments(ctx context.Context, client core.DocSource, url string) error {
 	// Validate the url to download
 	folderToken, err := utils.ValidateFolderURL(url)
 	if err != nil {
 		return err
 	}
-	fmt.Println("Captured folder token:", folderToken)
+	if dlPlan == nil {
+		fmt.Println("Captured folder token:", folderToken)
+	}
 
 	// Error channel and wait group
 	errChan := make(chan error)
 	wg := sync.WaitGroup{}
 
+	// The folders and documents walked through, as the shortcuts of shared
+	// folders may link each other into a cycle
+	visited := map[string]bool{folderToken: true}
+	claims := newPathClaims()
+
 	// Recursively go through the folder and download the documents
-	var processFolder func(ctx context.Context, folderPath, folderToken string) error
-	processFolder = func(ctx context.Context, folderPath, folderToken string) error {
-		files, err := client.GetDriveFolderFileList(ctx, nil, &folderToken)
+	var processFolder func(ctx context.Context, folderPath string, nodePath titlePath, folderToken string, depth int) error
+	processFolder = func(ctx context.Context, folderPath string, nodePath titlePath, folderToken string, depth int) error {
+		var files []*lark.GetDriveFileListRespFile
+		err := dlPool.Do(func() (err error) {
+			files, err = client.GetDriveFolderFileList(ctx, nil, &folderToken)
+			return err
+		})
 		if err != nil {
 			return err
 		}
-		opts := DownloadOpts{outputDir: folderPath, dump: dlOpts.dump, batch: false}
+
+		// the folder list lacks the owners and times to filter and name by
+		var metas map[string]*lark.GetDriveFileMetaRespMeta
+		if dlFilter.needsMetas(false) || templateNeedsTimes() {
+			var docs []*lark.GetDriveFileMetaReqRequestDocs
+			for _, file := range files {
+				objType, objToken := fileTarget(file)
+				if file.Type == "shortcut" && !dlOpts.shortcuts {
+					continue
+				}
+				if objType == "docx" || objectEnabled(objType) {
+					docs = append(docs, &lark.GetDriveFileMetaReqRequestDocs{DocToken: objToken, DocType: objType})
+				}
+			}
+			if metas, err = getFileMetas(ctx, client, docs); err != nil {
+				return err
+			}
+		}
+
 		for _, file := range files {
-			if file.Type == "folder" {
-				_folderPath := filepath.Join(folderPath, file.Name)
-				if err := processFolder(ctx, _folderPath, file.Token); err != nil {
+			objType, objToken := fileTarget(file)
+			objURL := file.URL
+			if file.Type == "shortcut" && file.ShortcutInfo != nil {
+				if !dlOpts.shortcuts {
+					continue
+				}
+				objURL = shortcutTargetURL(file.URL, objType, objToken)
+			}
+			filePath := nodePath.child(file.Name)
+			if objType == "folder" {
+				if dlOpts.maxDepth > 0 && depth >= dlOpts.maxDepth || dlFilter.excluded(filePath) {
+					continue
+				}
+			} else if !dlFilter.selectsMeta(filePath, metas[objToken]) {
+				continue
+			}
+			if visited[objToken] {
+				if dlPlan == nil {
+					fmt.Printf("Skipped %s visited before\n", filePath)
+				}
+				continue
+			}
+			visited[objToken] = true
+			if objType == "folder" {
+				_folderPath := claims.folderPath(folderPath, file.Name)
+				dlPlan.add(&planItem{Title: file.Name, Type: objType, Token: objToken,
+					NodePath: filePath.String(), Path: _folderPath, depth: len(nodePath)})
+				if err := processFolder(ctx, _folderPath, filePath, objToken, depth+1); err != nil {
 					return err
 				}
-			} else if file.Type == "docx" {
+				continue
+			}
+			if objType != "docx" && !objectEnabled(objType) {
+				warnSkipped(objType, filePath)
+				continue
+			}
+
+			data := &pathData{Title: file.Name, Token: objToken, Type: objType}
+			if meta, ok := metas[objToken]; ok {
+				data.Created, data.Modified = unixTime(meta.CreateTime), unixTime(meta.LatestModifyTime)
+			}
+			item := walkItem{nodePath: filePath, outputDir: folderPath,
+				pathRoot: dlOpts.outputDir, pathClaims: claims, pathData: data}
+			if item.outputPath, err = item.objectPath(data); err != nil {
+				return err
+			}
+			if dlPlan != nil {
+				dlPlan.add(&planItem{Title: file.Name, Type: objType, Token: objToken,
+					NodePath: filePath.String(), Path: item.outputPath, depth: len(nodePath)})
+			} else if objType == "docx" {
 				// concurrently download the document
 				wg.Add(1)
 				go func(_url string) {
-					if err := downloadDocument(ctx, client, _url, &opts); err != nil {
+					if err := downloadDocument(ctx, client, _url, &dlOpts, &item); err != nil {
 						errChan <- err
 					}
 					wg.Done()
-				}(file.URL)
+				}(objURL)
+			} else {
+				wg.Add(1)
+				go func(objType, objToken, title, _url string) {
+					if err := downloadObject(ctx, client, objType, objToken, title, _url, &item); err != nil {
+						errChan <- err
+					}
+					wg.Done()
+				}(objType, objToken, file.Name, objURL)
 			}
 		}
 		return nil
 	}
-	if err := processFolder(ctx, dlOpts.outputDir, folderToken); err != nil {
-		return err
-	}
+	err = processFolder(ctx, dlOpts.outputDir, nil, folderToken, 1)
 
 	// Wait for all the downloads to finish
 	go func() {
 		wg.Wait()
 		close(errChan)
 	}()
-	for err := range errChan {
-		return err
+	for dlErr := range errChan {
+		if err == nil {
+			err = dlErr
+		}
 	}
-	return nil
+	return err
 }
 
-func downloadWiki(ctx context.Context, client *core.Client, url string) error {
-	prefixURL, spaceID, err := utils.ValidateWikiURL(url)
-	if err != nil {
-		return err
+// wikiNodeItem converts the node info to an item of the node list
+func wikiNodeItem(node *lark.GetWikiNodeRespNode) *lark.GetWikiNodeListRespItem {
+	return &lark.GetWikiNodeListRespItem{
+		SpaceID:         node.SpaceID,
+		NodeToken:       node.NodeToken,
+		ObjToken:        node.ObjToken,
+		ObjType:         node.ObjType,
+		ParentNodeToken: node.ParentNodeToken,
+		NodeType:        node.NodeType,
+		OriginNodeToken: node.OriginNodeToken,
+		OriginSpaceID:   node.OriginSpaceID,
+		HasChild:        node.HasChild,
+		Title:           node.Title,
+		ObjCreateTime:   node.ObjCreateTime,
+		ObjEditTime:     node.ObjEditTime,
+		NodeCreateTime:  node.NodeCreateTime,
 	}
+}
 
-	folderPath, err := client.GetWikiName(ctx, spaceID)
-	if err != nil {
+// downloadWiki downloads all documents of a wiki space into a folder named
+// after it, or with a wiki node url, the node and all nodes below it.
+func downloadWiki(ctx context.Context, client core.DocSource, url string) error {
+	var rootNode *lark.GetWikiNodeListRespItem
+	var folderPath string
+	prefixURL, spaceID, err := utils.ValidateWikiURL(url)
+	if err == nil {
+		var wikiName string
+		err = dlPool.Do(func() (err error) {
+			wikiName, err = client.GetWikiName(ctx, spaceID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if wikiName == "" {
+			return fmt.Errorf("failed to GetWikiName")
+		}
+		folderPath = filepath.Join(dlOpts.outputDir, utils.SanitizeFileName(wikiName))
+	} else if _prefixURL, nodeToken, nodeErr := utils.ValidateWikiNodeURL(url); nodeErr == nil {
+		var node *lark.GetWikiNodeRespNode
+		err = dlPool.Do(func() (err error) {
+			node, err = client.GetWikiNodeInfo(ctx, nodeToken)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("GetWikiNodeInfo err: %w for %v", err, url)
+		}
+		prefixURL, spaceID = _prefixURL, node.SpaceID
+		rootNode = wikiNodeItem(node)
+		folderPath = dlOpts.outputDir
+	} else {
 		return err
 	}
-	if folderPath == "" {
-		return fmt.Errorf("failed to GetWikiName")
-	}
 
 	errChan := make(chan error)
-
-	var maxConcurrency = 10 // Set the maximum concurrency level
 	wg := sync.WaitGroup{}
-	semaphore := make(chan struct{}, maxConcurrency) // Create a semaphore with the maximum concurrency level
+
+	// the paths of the template are relative to the folder of the space
+	root := folderPath
+	claims := newPathClaims()
 
 	var downloadWikiNode func(ctx context.Context,
-		client *core.Client,
+		client core.DocSource,
 		spaceID string,
 		parentPath string,
+		parentNodePath titlePath,
 		parentNodeToken *string) error
 
+	// processNode downloads a node and the nodes below it
+	processNode := func(n *lark.GetWikiNodeListRespItem, folderPath string, nodePath titlePath,
+		metas map[string]*lark.GetDriveFileMetaRespMeta) error {
+		item := walkItem{nodePath: nodePath.child(n.Title), outputDir: folderPath}
+		if dlFilter.excluded(item.nodePath) {
+			return nil
+		}
+		owner := ""
+		if meta, ok := metas[n.ObjToken]; ok {
+			owner = meta.OwnerID
+		}
+		selected := (n.ObjType == "docx" || objectEnabled(n.ObjType)) &&
+			dlFilter.selects(item.nodePath, unixTime(n.ObjEditTime), owner)
+		warnSkipped(n.ObjType, item.nodePath)
+		var _folderPath string
+		if n.HasChild {
+			_folderPath = claims.folderPath(folderPath, n.Title)
+		}
+		// place the content of a node with children into its folder
+		if fileName, ok := wikiLayoutFileNames[dlOpts.wikiLayout]; ok && n.HasChild && n.ObjType == "docx" {
+			item.outputDir, item.fileName = _folderPath, fileName
+		}
+		if selected {
+			item.pathRoot, item.pathClaims = root, claims
+			item.pathData = &pathData{Title: n.Title, Token: n.ObjToken, Type: n.ObjType,
+				Created: unixTime(n.ObjCreateTime), Modified: unixTime(n.ObjEditTime)}
+			var err error
+			if item.outputPath, err = item.objectPath(item.pathData); err != nil {
+				return err
+			}
+		}
+		if selected || n.HasChild {
+			dlPlan.add(&planItem{Title: n.Title, Type: n.ObjType, Token: n.ObjToken,
+				NodeToken: n.NodeToken, NodePath: item.nodePath.String(), Path: item.outputPath,
+				depth: len(nodePath)})
+		}
+		if n.HasChild {
+			if err := downloadWikiNode(ctx, client,
+				spaceID, _folderPath, item.nodePath, &n.NodeToken); err != nil {
+				return err
+			}
+		}
+		if !selected || dlPlan != nil {
+			return nil
+		}
+		if n.ObjType == "docx" {
+			wg.Add(1)
+			go func(_url string) {
+				if err := downloadDocument(ctx, client, _url, &dlOpts, &item); err != nil {
+					errChan <- err
+				}
+				wg.Done()
+			}(prefixURL + "/wiki/" + n.NodeToken)
+		} else if objectEnabled(n.ObjType) {
+			wg.Add(1)
+			go func(_url string) {
+				if err := downloadObject(ctx, client, n.ObjType, n.ObjToken, n.Title, _url, &item); err != nil {
+					errChan <- err
+				}
+				wg.Done()
+			}(prefixURL + "/wiki/" + n.NodeToken)
+		}
+		return nil
+	}
+
 	downloadWikiNode = func(ctx context.Context,
-		client *core.Client,
+		client core.DocSource,
 		spaceID string,
 		folderPath string,
+		nodePath titlePath,
 		parentNodeToken *string) error {
-		nodes, err := client.GetWikiNodeList(ctx, spaceID, parentNodeToken)
+		var nodes []*lark.GetWikiNodeListRespItem
+		err := dlPool.Do(func() (err error) {
+			nodes, err = client.GetWikiNodeList(ctx, spaceID, parentNodeToken)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		metas, err := getWikiNodeMetas(ctx, client, nodes)
 		if err != nil {
 			return err
 		}
 		for _, n := range nodes {
-			if n.HasChild {
-				_folderPath := filepath.Join(folderPath, n.Title)
-				if err := downloadWikiNode(ctx, client,
-					spaceID, _folderPath, &n.NodeToken); err != nil {
-					return err
-				}
-			}
-			if n.ObjType == "docx" {
-				opts := DownloadOpts{outputDir: folderPath, dump: dlOpts.dump, batch: false}
-				wg.Add(1)
-				semaphore <- struct{}{}
-				go func(_url string) {
-					if err := downloadDocument(ctx, client, _url, &opts); err != nil {
-						errChan <- err
-					}
-					wg.Done()
-					<-semaphore
-				}(prefixURL + "/wiki/" + n.NodeToken)
-				// downloadDocument(ctx, client, prefixURL+"/wiki/"+n.NodeToken, &opts)
+			if err := processNode(n, folderPath, nodePath, metas); err != nil {
+				return err
 			}
 		}
 		return nil
 	}
 
-	if err = downloadWikiNode(ctx, client, spaceID, folderPath, nil); err != nil {
-		return err
+	if rootNode != nil {
+		var metas map[string]*lark.GetDriveFileMetaRespMeta
+		metas, err = getWikiNodeMetas(ctx, client, []*lark.GetWikiNodeListRespItem{rootNode})
+		if err == nil {
+			err = processNode(rootNode, folderPath, nil, metas)
+		}
+	} else {
+		err = downloadWikiNode(ctx, client, spaceID, folderPath, nil, nil)
 	}
 
 	// Wait for all the downloads to finish
@@ -238,37 +622,121 @@ func downloadWiki(ctx context.Context, client *core.Client, url string) error {
 		wg.Wait()
 		close(errChan)
 	}()
-	for err := range errChan {
-		return err
+	for dlErr := range errChan {
+		if err == nil {
+			err = dlErr
+		}
 	}
-	return nil
+	return err
 }
 
-func handleDownloadCommand(url string) error {
+func newDocxCache(config core.CacheConfig) (*core.DocxCache, error) {
+	dir := config.Dir
+	if dir == "" {
+		var err error
+		if dir, err = core.DefaultCacheDir(); err != nil {
+			return nil, err
+		}
+	}
+	return core.NewDocxCache(dir, int64(config.MaxSizeMB)<<20), nil
+}
+
+// newDownloadSource loads the config with the overrides of dlOpts and
+// instantiates the client to download url
+func newDownloadSource(url string) (core.DocSource, error) {
+	if _, ok := wikiLayoutFileNames[dlOpts.wikiLayout]; !ok && dlOpts.wikiLayout != WikiLayoutSibling {
+		return nil, errors.Errorf("Unknown wiki layout %q", dlOpts.wikiLayout)
+	}
+	if f := dlOpts.sheetFormat; f != "" && f != SheetFormatCSV && f != SheetFormatXLSX {
+		return nil, errors.Errorf("Unknown sheet format %q", f)
+	}
+	filter, err := newNodeFilter(&dlOpts)
+	if err != nil {
+		return nil, err
+	}
+	dlFilter = filter
+
 	// Load config
 	configPath, err := core.GetConfigFilePath()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	config, err := core.ReadConfigFromFile(configPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	dlConfig = *config
+	if dlOpts.pathTmpl != "" {
+		dlConfig.Output.PathTemplate = dlOpts.pathTmpl
+	}
+	if dlTemplate, err = parsePathTemplate(dlConfig.Output.PathTemplate); err != nil {
+		return nil, err
+	}
+	if dlOpts.rateLimit > 0 {
+		dlConfig.Feishu.RateLimit = dlOpts.rateLimit
+	}
+	if dlOpts.rateBurst > 0 {
+		dlConfig.Feishu.RateBurst = dlOpts.rateBurst
+	}
+	if dlOpts.workers > 0 {
+		dlConfig.Feishu.Workers = dlOpts.workers
+	}
+	dlPool = newWorkerPool(dlConfig.Feishu.Workers)
 
 	// Instantiate the client
-	client := core.NewClient(
-		dlConfig.Feishu.AppId, dlConfig.Feishu.AppSecret,
-	)
+	larkClient, err := newClient(&dlConfig, url)
+	if err != nil {
+		return nil, err
+	}
+	if dlOpts.noCache {
+		return larkClient, nil
+	}
+	cache, err := newDocxCache(dlConfig.Cache)
+	if err != nil {
+		return nil, err
+	}
+	return &core.CachedSource{DocSource: larkClient, Cache: cache}, nil
+}
+
+func handleDownloadCommand(url string) error {
+	client, err := newDownloadSource(url)
+	if err != nil {
+		return err
+	}
 	ctx := context.Background()
 
+	if dlOpts.dryRun {
+		dlPlan = &plan{}
+		defer func() { dlPlan = nil }()
+	} else if dlOpts.batch || dlOpts.wiki || dlOpts.recursive {
+		dlManifest = newManifest(dlOpts.outputDir)
+		defer func() { dlManifest = nil }()
+	}
 	if dlOpts.batch {
-		return downloadDocuments(ctx, client, url)
+		err = downloadDocuments(ctx, client, url)
+	} else if dlOpts.wiki || dlOpts.recursive {
+		err = downloadWiki(ctx, client, url)
+	} else {
+		err = downloadDocument(ctx, client, url, &dlOpts, &walkItem{outputDir: dlOpts.outputDir})
 	}
-
-	if dlOpts.wiki {
-		return downloadWiki(ctx, client, url)
+	if dlManifest != nil {
+		if linkErr := dlManifest.rewriteLinks(); linkErr != nil && err == nil {
+			err = linkErr
+		}
+		// the manifest also records the failed documents
+		if writeErr := dlManifest.write(); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		return err
 	}
 
-	return downloadDocument(ctx, client, url, &dlOpts)
+	if dlPlan != nil {
+		return dlPlan.print(os.Stdout, dlOpts.json)
+	}
+	if dlOpts.tasksIndex {
+		return dlTasks.write(dlOpts.outputDir)
+	}
+	return nil
 }
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/core/fakefeishu"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSource loads the testdata documents into a MemorySource and
+// serves a placeholder png for every image they reference.
+func newTestSource(t *testing.T) (*core.MemorySource, []string) {
+	source := core.NewMemorySource()
+	var docTokens []string
+	for _, td := range []string{"testdocx.1", "testdocx.2"} {
+		docToken, err := source.LoadDocxDump(
+			filepath.Join(utils.RootDir(), "testdata", td+".json"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docTokens = append(docTokens, docToken)
+
+		dump := source.Documents[docToken]
+		parser := core.NewParser(core.NewConfig("", "").Output)
+		parser.ParseDocxContent(dump.Document, dump.Blocks)
+		for _, imgToken := range parser.ImgTokens {
+			source.Files[imgToken] = &core.MemoryFile{Name: "image.png", Data: []byte("png")}
+		}
+	}
+	return source, docTokens
+}
+
+func setupDownload(t *testing.T) string {
+	outputDir := t.TempDir()
+	dlConfig = *core.NewConfig("", "")
+	dlOpts = DownloadOpts{outputDir: outputDir}
+	dlPool = nil
+	dlFilter = nil
+	dlTemplate = nil
+	dlUserNames = userNames{}
+	return outputDir
+}
+
+func TestDownloadDocument(t *testing.T) {
+	outputDir := setupDownload(t)
+	source, docTokens := newTestSource(t)
+
+	url := "https://sample.feishu.cn/docx/" + docTokens[0]
+	err := downloadDocument(context.Background(), source, url, &dlOpts, &walkItem{outputDir: outputDir})
+	assert.NoError(t, err)
+
+	markdown, err := os.ReadFile(filepath.Join(outputDir, docTokens[0]+".md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(markdown), "# 一日一技：飞书文档转换为 Markdown")
+	assert.Contains(t, string(markdown), filepath.Join(outputDir, "static"))
+
+	images, err := os.ReadDir(filepath.Join(outputDir, "static"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, images)
+}
+
+func TestDownloadDocuments(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlConfig.Output.SkipImgDownload = true
+	source, docTokens := newTestSource(t)
+
+	source.Folders["fldcnRoot"] = []*lark.GetDriveFileListRespFile{
+		{Token: "fldcnSub", Name: "sub", Type: "folder"},
+		{Token: docTokens[0], Name: "first", Type: "docx",
+			URL: "https://sample.feishu.cn/docx/" + docTokens[0]},
+		{Token: "shtcnSheet", Name: "sheet", Type: "sheet"},
+	}
+	source.Folders["fldcnSub"] = []*lark.GetDriveFileListRespFile{
+		{Token: docTokens[1], Name: "second", Type: "docx",
+			URL: "https://sample.feishu.cn/docx/" + docTokens[1]},
+	}
+
+	err := downloadDocuments(context.Background(), source,
+		"https://sample.feishu.cn/drive/folder/fldcnRoot")
+	assert.NoError(t, err)
+
+	for _, docToken := range docTokens[:1] {
+		title := source.Documents[docToken].Document.Title
+		assert.FileExists(t, filepath.Join(outputDir, utils.SanitizeFileName(title)+".md"))
+	}
+	title := source.Documents[docTokens[1]].Document.Title
+	assert.FileExists(t, filepath.Join(outputDir, "sub", utils.SanitizeFileName(title)+".md"))
+}
+
+func TestDownloadDocumentsTasksIndex(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.SkipImgDownload = true
+	dlOpts.tasksIndex = true
+	dlTasks = taskIndex{}
+	source, docTokens := newTestSource(t)
+
+	dump := source.Documents[docTokens[0]]
+	page := dump.Blocks[0]
+	page.Children = append(page.Children, "todo", "task")
+	dump.Blocks = append(dump.Blocks, &lark.DocxBlock{
+		BlockID: "todo", ParentID: page.BlockID, BlockType: lark.DocxBlockTypeTodo,
+		Todo: &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+			{TextRun: &lark.DocxTextElementTextRun{Content: "Review the draft"}},
+		}},
+	}, &lark.DocxBlock{
+		BlockID: "task", ParentID: page.BlockID, BlockType: core.DocxBlockTypeTask,
+	})
+	source.Tasks["task"] = &core.DocxTask{GUID: "guid", Summary: "Ship the release",
+		Members: []*core.DocxTaskMember{{ID: "ou_bob", Role: "assignee"}, {ID: "ou_carol", Role: "assignee"}}}
+	// the open id is kept when the name can't be looked up
+	source.Users["ou_bob"] = "Bob"
+	source.Folders["fldcnRoot"] = []*lark.GetDriveFileListRespFile{
+		{Token: docTokens[0], Name: "first", Type: "docx",
+			URL: "https://sample.feishu.cn/docx/" + docTokens[0]},
+	}
+
+	err := downloadDocuments(context.Background(), source,
+		"https://sample.feishu.cn/drive/folder/fldcnRoot")
+	assert.NoError(t, err)
+	assert.NoError(t, dlTasks.write(outputDir))
+	tasks, err := os.ReadFile(filepath.Join(outputDir, "tasks.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(tasks), "](<"+docTokens[0]+".md>)\n\n- [ ] Review the draft\n- [ ] Ship the release @Bob @ou_carol\n")
+}
+
+func TestDownloadWiki(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.SkipImgDownload = true
+	source, docTokens := newTestSource(t)
+
+	source.WikiSpaces["7000"] = "Handbook"
+	source.WikiNodes = []*lark.GetWikiNodeListRespItem{
+		{SpaceID: "7000", NodeToken: "wikcnParent", ObjToken: docTokens[0],
+			ObjType: "docx", Title: "Parent", HasChild: true},
+		{SpaceID: "7000", NodeToken: "wikcnChild", ObjToken: docTokens[1],
+			ObjType: "docx", Title: "Child", ParentNodeToken: "wikcnParent"},
+	}
+
+	err := downloadWiki(context.Background(), source,
+		"https://sample.feishu.cn/wiki/settings/7000")
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(outputDir, "Handbook", docTokens[0]+".md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Handbook", "Parent", docTokens[1]+".md"))
+}
+
+func newFakeClient(t *testing.T) (*fakefeishu.Server, *core.Client) {
+	server, err := fakefeishu.NewServerFromDir(filepath.Join(utils.RootDir(), "testdata", "fakefeishu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	server.PageSize = 1
+	return server, core.NewClient("cli_fake", "secret",
+		core.WithBaseURL(server.URL), core.WithRateLimit(100, 10))
+}
+
+func TestDownloadDocumentsFromServer(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	// a single worker is shared by the documents and their images
+	dlPool = newWorkerPool(1)
+	_, client := newFakeClient(t)
+
+	err := downloadDocuments(context.Background(), client,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeRoot")
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(outputDir, "Release Notes.md"))
+	assert.FileExists(t, filepath.Join(outputDir, "static", "boxcnFakeDiagram0000000001.png"))
+	assert.FileExists(t, filepath.Join(outputDir, "Guides", "Install Guide.md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Guides", "FAQ.md"))
+}
+
+func TestDownloadWikiFromServer(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlConfig.Output.SkipImgDownload = true
+	_, client := newFakeClient(t)
+
+	err := downloadWiki(context.Background(), client,
+		"https://sample.feishu.cn/wiki/settings/7100000000000000001")
+	assert.NoError(t, err)
+
+	markdown, err := os.ReadFile(filepath.Join(outputDir, "Handbook", "Release Notes.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(markdown), "Version 1.0 is out.")
+	assert.FileExists(t, filepath.Join(outputDir, "Handbook", "Release Notes", "Install Guide.md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Handbook", "Release Notes", "FAQ.md"))
+}
+
+func TestDownloadDocumentFromServerError(t *testing.T) {
+	setupDownload(t)
+	server, client := newFakeClient(t)
+	server.Fail("/open-apis/drive/v1/files", http.StatusForbidden, 1061004, "forbidden")
+
+	err := downloadDocuments(context.Background(), client,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeRoot")
+	assert.Error(t, err)
+}
+
+func TestDownloadWikiManifest(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	source := newSyncSource(t).MemorySource
+	delete(source.Documents, "doxcnFakeInstallGuide00001")
+	dlManifest = newManifest(outputDir)
+	defer func() { dlManifest = nil }()
+
+	err := downloadWiki(context.Background(), source,
+		"https://sample.feishu.cn/wiki/settings/7100000000000000001")
+	assert.Error(t, err)
+	assert.NoError(t, dlManifest.write())
+
+	// the other documents are downloaded despite the failure
+	m, err := readManifest(outputDir)
+	assert.NoError(t, err)
+	assert.Len(t, m.prev, 3)
+
+	notes := m.prev["doxcnFakeReleaseNotes000001"]
+	assert.Equal(t, "Release Notes", notes.Title)
+	assert.Equal(t, "https://sample.feishu.cn/wiki/wikcnFakeReleaseNotes", notes.URL)
+	assert.Equal(t, "Release Notes", notes.NodePath)
+	assert.Equal(t, "Handbook/Release Notes.md", notes.Path)
+	assert.Equal(t, "Handbook/static/boxcnFakeDiagram0000000001.png",
+		notes.Images["boxcnFakeDiagram0000000001"].Path)
+	assert.Empty(t, notes.Error)
+
+	faq := m.prev["doxcnFakeFaq0000000000001"]
+	assert.Equal(t, "Release Notes/FAQ", faq.NodePath)
+	assert.Equal(t, "Handbook/Release Notes/FAQ.md", faq.Path)
+
+	guide := m.prev["doxcnFakeInstallGuide00001"]
+	assert.Equal(t, "https://sample.feishu.cn/wiki/wikcnFakeInstallGuide", guide.URL)
+	assert.Equal(t, "Release Notes/Install Guide", guide.NodePath)
+	assert.Empty(t, guide.Path)
+	assert.Contains(t, guide.Error, "not found")
+}
+
+func TestDownloadWikiSubtree(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlConfig.Output.SkipImgDownload = true
+	_, client := newFakeClient(t)
+
+	err := downloadWiki(context.Background(), client,
+		"https://sample.feishu.cn/wiki/wikcnFakeReleaseNotes")
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(outputDir, "Release Notes.md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Release Notes", "Install Guide.md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Release Notes", "FAQ.md"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "Handbook"))
+
+	outputDir = setupDownload(t)
+	err = downloadWiki(context.Background(), client,
+		"https://sample.feishu.cn/wiki/wikcnFakeFaq?from=from_copylink")
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(outputDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "doxcnFakeFaq0000000000001.md", entries[0].Name())
+}
+
+func TestDownloadWikiLayout(t *testing.T) {
+	for layout, fileName := range wikiLayoutFileNames {
+		t.Run(layout, func(t *testing.T) {
+			outputDir := setupDownload(t)
+			dlConfig.Output.TitleAsFilename = true
+			dlConfig.Output.SkipImgDownload = true
+			dlOpts.wikiLayout = layout
+			source := newSyncSource(t).MemorySource
+
+			err := downloadWiki(context.Background(), source,
+				"https://sample.feishu.cn/wiki/settings/7100000000000000001")
+			assert.NoError(t, err)
+
+			wikiDir := filepath.Join(outputDir, "Handbook")
+			assert.FileExists(t, filepath.Join(wikiDir, "Release Notes", fileName))
+			assert.NoFileExists(t, filepath.Join(wikiDir, "Release Notes.md"))
+			assert.FileExists(t, filepath.Join(wikiDir, "Release Notes", "FAQ.md"))
+		})
+	}
+}
+
+func TestDownloadObjectsFromServer(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlOpts.sheetFormat = SheetFormatCSV
+	dlOpts.bitables = true
+	dlOpts.files = true
+	dlOpts.shortcuts = true
+	dlManifest = newManifest(outputDir)
+	t.Cleanup(func() { dlManifest = nil })
+	_, client := newFakeClient(t)
+
+	err := downloadDocuments(context.Background(), client,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeGuides")
+	assert.NoError(t, err)
+
+	budget, err := os.ReadFile(filepath.Join(outputDir, "Budget", "2024.csv"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(budget), "Item,Cost\nServers,1200.5\n\"Domains, DNS\",30\n")
+	assert.FileExists(t, filepath.Join(outputDir, "Budget", "2025.csv"))
+	roadmap, err := os.ReadFile(filepath.Join(outputDir, "Roadmap.csv"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(roadmap), "Milestone,Status\n")
+	assert.FileExists(t, filepath.Join(outputDir, "Manual.pdf"))
+	assert.FileExists(t, filepath.Join(outputDir, "FAQ.md"))
+
+	entry := dlManifest.docs["shtcnFakeBudget"]
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, "sheet", entry.Type)
+		assert.Equal(t, "https://sample.feishu.cn/sheets/shtcnFakeBudget", entry.URL)
+		assert.Equal(t, "Budget/2024.csv", entry.Path)
+		assert.Equal(t, []string{"Budget/2025.csv"}, entry.Files)
+	}
+}
+
+func TestDownloadSheetXLSX(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlOpts.sheetFormat = SheetFormatXLSX
+	source := newSyncSource(t)
+
+	err := downloadObject(context.Background(), source, "sheet", "shtcnFakeBudget", "Budget",
+		"https://sample.feishu.cn/sheets/shtcnFakeBudget", &walkItem{outputDir: outputDir})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "shtcnFakeBudget.xlsx"))
+
+	// the objects are skipped unless enabled
+	dlOpts.sheetFormat = ""
+	assert.False(t, objectEnabled("sheet"))
+	assert.False(t, objectEnabled("mindnote"))
+}
+
+func TestDownloadDocumentsShortcutCycle(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlOpts.shortcuts = true
+	source := newSyncSource(t)
+	// the guides link back to the root folder, and the root to the FAQ
+	source.Folders["fldcnFakeGuides"] = append(source.Folders["fldcnFakeGuides"],
+		&lark.GetDriveFileListRespFile{Token: "nodcnFakeRootShortcut", Name: "Home", Type: "shortcut",
+			URL:          "https://sample.feishu.cn/drive/folder/fldcnFakeRoot",
+			ShortcutInfo: &lark.GetDriveFileListRespFileShortcutInfo{TargetType: "folder", TargetToken: "fldcnFakeRoot"}})
+	source.Folders["fldcnFakeRoot"] = append(source.Folders["fldcnFakeRoot"],
+		&lark.GetDriveFileListRespFile{Token: "nodcnFakeFaqShortcut", Name: "FAQ", Type: "shortcut",
+			URL:          "https://sample.feishu.cn/docx/doxcnFakeFaq0000000000001",
+			ShortcutInfo: &lark.GetDriveFileListRespFileShortcutInfo{TargetType: "docx", TargetToken: "doxcnFakeFaq0000000000001"}})
+
+	err := downloadDocuments(context.Background(), source,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeRoot")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, source.downloads)
+	assert.FileExists(t, filepath.Join(outputDir, "Guides", "Install Guide.md"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "Guides", "Home"))
+
+	// a max depth of 1 skips the subfolders
+	outputDir = setupDownload(t)
+	dlOpts.maxDepth = 1
+	source = newSyncSource(t)
+	err = downloadDocuments(context.Background(), source,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeRoot")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, source.downloads)
+	assert.NoDirExists(t, filepath.Join(outputDir, "Guides"))
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+)
+
+// nodeFilter selects the documents of a batch or wiki download by their
+// path, modified time and owner. A nil filter selects all documents.
+type nodeFilter struct {
+	includes      []*nodePattern
+	excludes      []*nodePattern
+	modifiedSince time.Time
+	owner         string
+}
+
+// titlePath is the titles of a node and its parents from the root. The
+// titles are kept apart as they may contain slashes.
+type titlePath []string
+
+// nodePattern is a glob, or a regexp within slashes like /^Draft/, matched
+// against the title and the path of a node and its parents
+type nodePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// dlFilter is only set when a filter flag is given
+var dlFilter *nodeFilter
+
+// child returns the path of a child node, without sharing the array of p
+func (p titlePath) child(title string) titlePath {
+	return append(p[:len(p):len(p)], title)
+}
+
+// String joins the titles with slashes, for display
+func (p titlePath) String() string {
+	return strings.Join(p, "/")
+}
+
+func newNodePattern(pattern string) (*nodePattern, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		return &nodePattern{re: re}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	return &nodePattern{glob: pattern}, nil
+}
+
+// match tells whether the pattern matches the node path, one of its
+// parents, or their titles
+func (p *nodePattern) match(nodePath titlePath) bool {
+	for i := len(nodePath); i > 0; i-- {
+		for _, s := range []string{nodePath[:i].String(), nodePath[i-1]} {
+			if p.re != nil && p.re.MatchString(s) {
+				return true
+			}
+			if ok, _ := path.Match(p.glob, s); p.re == nil && ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseDate parses a date like 2024-01-31 in local time or a RFC 3339 time
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %s, expecting 2006-01-02 or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// newNodeFilter returns the filter of the flags, or nil without any
+func newNodeFilter(opts *DownloadOpts) (*nodeFilter, error) {
+	f := &nodeFilter{owner: opts.owner}
+	for _, pattern := range opts.includes.Value() {
+		p, err := newNodePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.includes = append(f.includes, p)
+	}
+	for _, pattern := range opts.excludes.Value() {
+		p, err := newNodePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.excludes = append(f.excludes, p)
+	}
+	if opts.modified != "" {
+		t, err := parseDate(opts.modified)
+		if err != nil {
+			return nil, err
+		}
+		f.modifiedSince = t
+	}
+	if len(f.includes) == 0 && len(f.excludes) == 0 && f.modifiedSince.IsZero() && f.owner == "" {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// excluded tells whether the node and the nodes below it are skipped
+func (f *nodeFilter) excluded(nodePath titlePath) bool {
+	if f == nil {
+		return false
+	}
+	for _, p := range f.excludes {
+		if p.match(nodePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// selects tells whether the document is downloaded. The modified time and
+// owner are only known with the metas of the documents.
+func (f *nodeFilter) selects(nodePath titlePath, modified time.Time, owner string) bool {
+	if f == nil {
+		return true
+	}
+	if f.excluded(nodePath) {
+		return false
+	}
+	if len(f.includes) > 0 {
+		included := false
+		for _, p := range f.includes {
+			if p.match(nodePath) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	if !f.modifiedSince.IsZero() && modified.Before(f.modifiedSince) {
+		return false
+	}
+	return f.owner == "" || f.owner == owner
+}
+
+// selectsMeta tells whether the document is downloaded by its meta, if any
+func (f *nodeFilter) selectsMeta(nodePath titlePath, meta *lark.GetDriveFileMetaRespMeta) bool {
+	if meta == nil {
+		return f.selects(nodePath, time.Time{}, "")
+	}
+	return f.selects(nodePath, unixTime(meta.LatestModifyTime), meta.OwnerID)
+}
+
+// needsMetas tells whether the metas of the documents are queried, as the
+// folder and wiki lists lack the owners, and the folder lists the modified
+// times
+func (f *nodeFilter) needsMetas(wiki bool) bool {
+	if f == nil {
+		return false
+	}
+	return f.owner != "" || (!wiki && !f.modifiedSince.IsZero())
+}
+
+// getFileMetas queries the metas of the documents by token
+func getFileMetas(ctx context.Context, client core.DocSource, docs []*lark.GetDriveFileMetaReqRequestDocs) (map[string]*lark.GetDriveFileMetaRespMeta, error) {
+	metas := make(map[string]*lark.GetDriveFileMetaRespMeta)
+	if len(docs) == 0 {
+		return metas, nil
+	}
+	var items []*lark.GetDriveFileMetaRespMeta
+	err := dlPool.Do(func() (err error) {
+		items, err = client.GetDriveFileMetas(ctx, docs)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetDriveFileMetas err: %w", err)
+	}
+	for _, meta := range items {
+		metas[meta.DocToken] = meta
+	}
+	return metas, nil
+}
+
+// getWikiNodeMetas queries the metas of the nodes for their owners, only
+// if the filter needs them
+func getWikiNodeMetas(ctx context.Context, client core.DocSource, nodes []*lark.GetWikiNodeListRespItem) (map[string]*lark.GetDriveFileMetaRespMeta, error) {
+	if !dlFilter.needsMetas(true) {
+		return nil, nil
+	}
+	var docs []*lark.GetDriveFileMetaReqRequestDocs
+	for _, n := range nodes {
+		if n.ObjType == "docx" || objectEnabled(n.ObjType) {
+			docs = append(docs, &lark.GetDriveFileMetaReqRequestDocs{DocToken: n.ObjToken, DocType: n.ObjType})
+		}
+	}
+	return getFileMetas(ctx, client, docs)
+}
+
+// unixTime converts a unix timestamp in seconds of the Open API
+func unixTime(s string) time.Time {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
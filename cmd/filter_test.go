@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func TestNodeFilter(t *testing.T) {
+	opts := &DownloadOpts{}
+	filter, err := newNodeFilter(opts)
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+	assert.True(t, filter.selects(titlePath{"Guides", "FAQ"}, time.Time{}, ""))
+
+	assert.NoError(t, opts.includes.Set("Guides"))
+	assert.NoError(t, opts.excludes.Set("/^Draft/"))
+	opts.modified = "2024-01-01"
+	filter, err = newNodeFilter(opts)
+	assert.NoError(t, err)
+	modified := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	// included by a parent
+	assert.True(t, filter.selects(titlePath{"Guides", "FAQ"}, modified, ""))
+	assert.False(t, filter.selects(titlePath{"Release Notes"}, modified, ""))
+	assert.True(t, filter.excluded(titlePath{"Guides", "Drafts"}))
+	assert.False(t, filter.selects(titlePath{"Guides", "Drafts", "FAQ"}, modified, ""))
+	assert.False(t, filter.selects(titlePath{"Guides", "FAQ"}, modified.AddDate(-1, 0, 0), ""))
+	// a title with a slash is not split into parents
+	assert.False(t, filter.selects(titlePath{"Guides/Drafts"}, modified, ""))
+	assert.True(t, filter.selects(titlePath{"Guides", "Q1/Q2"}, modified, ""))
+
+	opts.excludes = cli.StringSlice{}
+	assert.NoError(t, opts.excludes.Set("Q1"))
+	assert.NoError(t, opts.excludes.Set("Q1/*"))
+	filter, err = newNodeFilter(opts)
+	assert.NoError(t, err)
+	assert.True(t, filter.excluded(titlePath{"Guides", "Q1/Q2"}))
+	assert.True(t, filter.excluded(titlePath{"Q1", "FAQ"}))
+	opts.excludes = cli.StringSlice{}
+	assert.NoError(t, opts.excludes.Set("Q1"))
+	filter, err = newNodeFilter(opts)
+	assert.NoError(t, err)
+	assert.False(t, filter.excluded(titlePath{"Guides", "Q1/Q2", "FAQ"}))
+
+	opts.modified = "last week"
+	_, err = newNodeFilter(opts)
+	assert.Error(t, err)
+	opts.modified = ""
+	assert.NoError(t, opts.includes.Set("[Guides"))
+	_, err = newNodeFilter(opts)
+	assert.Error(t, err)
+}
+
+func TestDownloadDocumentsFiltered(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlOpts.owner = "ou_fake_alice"
+	dlOpts.modified = "2024-01-01"
+	var err error
+	dlFilter, err = newNodeFilter(&dlOpts)
+	assert.NoError(t, err)
+	_, client := newFakeClient(t)
+
+	err = downloadDocuments(context.Background(), client,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeRoot")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "Guides", "FAQ.md"))
+	// owned by another user
+	assert.NoFileExists(t, filepath.Join(outputDir, "Guides", "Install Guide.md"))
+	// modified before the date
+	assert.NoFileExists(t, filepath.Join(outputDir, "Release Notes.md"))
+}
+
+func TestDownloadWikiExcluded(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlConfig.Output.SkipImgDownload = true
+	assert.NoError(t, dlOpts.excludes.Set("Release*"))
+	var err error
+	dlFilter, err = newNodeFilter(&dlOpts)
+	assert.NoError(t, err)
+	server, client := newFakeClient(t)
+
+	err = downloadWiki(context.Background(), client,
+		"https://sample.feishu.cn/wiki/settings/7100000000000000001")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(outputDir, "Handbook", "Release Notes.md"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "Handbook", "Release Notes"))
+	// the excluded subtree is never fetched
+	for _, r := range server.Requests() {
+		assert.False(t, strings.Contains(r, "parent_node_token=wikcnFakeReleaseNotes"), r)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+var (
+	markdownLinkRegexp = regexp.MustCompile(`\]\((<[^>]*>|[^)\s]*)\)`)
+	feishuDocRegexp    = regexp.MustCompile(`^https://[\w-.]+/(?:docx|wiki)/([a-zA-Z0-9]+)[^#]*(?:#(.*))?$`)
+)
+
+// rewriteLinks rewrites the links and mentions between the exported
+// documents, by docx or wiki node url, to relative paths. A link to a
+// heading block points to the heading anchor of the target document. The
+// relative links of the last sync are updated to where their documents
+// moved. External links are left untouched.
+func (m *manifest) rewriteLinks() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	targets := make(map[string]*manifestEntry)
+	for docToken, entry := range m.docs {
+		if entry.Path == "" {
+			continue
+		}
+		targets[docToken] = entry
+		if docType, nodeToken, err := utils.ValidateDocumentURL(entry.URL); err == nil && docType == "wiki" {
+			targets[nodeToken] = entry
+		}
+	}
+	prevTokens := make(map[string]string)
+	for docToken, entry := range m.prev {
+		if entry.Path != "" {
+			prevTokens[entry.Path] = docToken
+		}
+	}
+
+	for docToken, entry := range m.docs {
+		if !strings.HasSuffix(entry.Path, ".md") {
+			continue
+		}
+		// the relative links of a reused file are relative to its last path
+		basePath := entry.Path
+		if prev, ok := m.prev[docToken]; ok && prev.Path != "" {
+			basePath = prev.Path
+		}
+		resolve := func(link string) (*manifestEntry, string, bool) {
+			if matches := feishuDocRegexp.FindStringSubmatch(link); matches != nil {
+				target, ok := targets[matches[1]]
+				if !ok {
+					return nil, "", false
+				}
+				// the fragment of a heading block is mapped to its anchor,
+				// any other fragment is kept as is
+				fragment := matches[2]
+				if slug, ok := target.Anchors[strings.TrimPrefix(fragment, "share-")]; ok {
+					fragment = slug
+				}
+				if fragment != "" {
+					fragment = "#" + fragment
+				}
+				return target, fragment, true
+			}
+			link, fragment, _ := strings.Cut(link, "#")
+			if strings.Contains(link, "://") || !strings.HasSuffix(link, ".md") {
+				return nil, "", false
+			}
+			docToken, ok := prevTokens[path.Join(path.Dir(basePath), link)]
+			if !ok {
+				return nil, "", false
+			}
+			target, ok := targets[docToken]
+			if fragment != "" {
+				fragment = "#" + fragment
+			}
+			return target, fragment, ok
+		}
+
+		data, err := os.ReadFile(m.abs(entry.Path))
+		if err != nil {
+			return err
+		}
+		markdown := string(data)
+		result := markdownLinkRegexp.ReplaceAllStringFunc(markdown, func(s string) string {
+			link := strings.TrimSuffix(strings.TrimPrefix(s, "]("), ")")
+			link = strings.TrimSuffix(strings.TrimPrefix(link, "<"), ">")
+			target, fragment, ok := resolve(link)
+			if !ok {
+				return s
+			}
+			rel, err := filepath.Rel(
+				filepath.Dir(filepath.FromSlash(entry.Path)), filepath.FromSlash(target.Path))
+			if err != nil {
+				return s
+			}
+			return fmt.Sprintf("](<%s%s>)", filepath.ToSlash(rel), fragment)
+		})
+		if result == markdown {
+			continue
+		}
+		if err = os.WriteFile(m.abs(entry.Path), []byte(result), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Rewrote links of %s\n", m.abs(entry.Path))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlConfig.Output.SkipImgDownload = true
+	syncOpts = SyncOpts{}
+	source := newSyncSource(t)
+	guide := source.Documents["doxcnFakeInstallGuide00001"].Blocks[1]
+	guide.BlockType, guide.Heading2, guide.Text = lark.DocxBlockTypeHeading2, guide.Text, nil
+	faq := source.Documents["doxcnFakeFaq0000000000001"]
+	text := faq.Blocks[1].Text
+	text.Elements = append(text.Elements,
+		&lark.DocxTextElement{MentionDoc: &lark.DocxTextElementMentionDoc{
+			Token: "doxcnFakeInstallGuide00001", ObjType: 22, Title: "Install Guide",
+			URL: "https%3A%2F%2Fsample.feishu.cn%2Fwiki%2FwikcnFakeInstallGuide",
+		}},
+		&lark.DocxTextElement{TextRun: &lark.DocxTextElementTextRun{
+			Content: "notes",
+			TextElementStyle: &lark.DocxTextElementStyle{Link: &lark.DocxTextElementStyleLink{
+				URL: "https%3A%2F%2Fsample.feishu.cn%2Fdocx%2FdoxcnFakeReleaseNotes000001%3Ffrom%3Dwiki",
+			}},
+		}},
+		&lark.DocxTextElement{TextRun: &lark.DocxTextElementTextRun{
+			Content: "download",
+			TextElementStyle: &lark.DocxTextElementStyle{Link: &lark.DocxTextElementStyleLink{
+				URL: "https%3A%2F%2Fsample.feishu.cn%2Fwiki%2FwikcnFakeInstallGuide%23share-doxcnFakeInstallGuidText0",
+			}},
+		}},
+		&lark.DocxTextElement{TextRun: &lark.DocxTextElementTextRun{
+			Content: "install",
+			TextElementStyle: &lark.DocxTextElementStyle{Link: &lark.DocxTextElementStyleLink{
+				URL: "https%3A%2F%2Fsample.feishu.cn%2Fdocx%2FdoxcnFakeInstallGuide00001%3Ffrom%3Dwiki%23doxcnFakeInstallGuidText1",
+			}},
+		}},
+		&lark.DocxTextElement{TextRun: &lark.DocxTextElementTextRun{
+			Content: "issues",
+			TextElementStyle: &lark.DocxTextElementStyle{Link: &lark.DocxTextElementStyleLink{
+				URL: "https%3A%2F%2Fgithub.com%2FWsine%2Ffeishu2md%2Fissues",
+			}},
+		}},
+	)
+	url := "https://sample.feishu.cn/wiki/settings/7100000000000000001"
+
+	err := syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	markdown, err := os.ReadFile(filepath.Join(outputDir, "Handbook", "Release Notes", "FAQ.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(markdown), "[Install Guide](<Install Guide.md>)")
+	assert.Contains(t, string(markdown), "[notes](<../Release Notes.md>)")
+	assert.Contains(t, string(markdown), "[download](<Install Guide.md#download-the-binary>)")
+	assert.Contains(t, string(markdown), "[install](<Install Guide.md#doxcnFakeInstallGuidText1>)")
+	assert.Contains(t, string(markdown), "[issues](https://github.com/Wsine/feishu2md/issues)")
+
+	// the links follow the moved documents without downloading them again
+	source.WikiNodes[2].ParentNodeToken = ""
+	err = syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, source.downloads)
+	markdown, err = os.ReadFile(filepath.Join(outputDir, "Handbook", "FAQ.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(markdown), "[Install Guide](<Release Notes/Install Guide.md>)")
+	assert.Contains(t, string(markdown), "[notes](<Release Notes.md>)")
+	assert.Contains(t, string(markdown), "[download](<Release Notes/Install Guide.md#download-the-binary>)")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+)
+
+type LoginOpts struct {
+	port int
+}
+
+var loginOpts = LoginOpts{}
+
+// loginTimeout is how long to wait for the user to authorize in the browser
+const loginTimeout = 5 * time.Minute
+
+// login runs the OAuth authorization code flow. It listens on addr for the
+// redirect of the authorization page, which is shown to the user by prompt.
+func login(ctx context.Context, client *core.Client, addr string, prompt func(authURL string)) (*core.UserToken, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr().String())
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	state := hex.EncodeToString(buf)
+
+	type callback struct {
+		code string
+		err  error
+	}
+	callbackChan := make(chan callback, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			http.Error(w, "Invalid state of the login", http.StatusBadRequest)
+			return
+		}
+		var result callback
+		if reason := query.Get("error"); reason != "" {
+			// the user denied the authorization or it failed
+			result.err = errors.Errorf("login failed: %s", reason)
+			http.Error(w, "feishu2md "+result.err.Error(), http.StatusForbidden)
+		} else if result.code = query.Get("code"); result.code == "" {
+			http.Error(w, "Missing code of the login", http.StatusBadRequest)
+			return
+		} else {
+			fmt.Fprintln(w, "feishu2md login succeeded, you can close this page now.")
+		}
+		select {
+		case callbackChan <- result:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	prompt(client.OAuthURL(ctx, redirectURI, state))
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+	select {
+	case result := <-callbackChan:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return client.ExchangeCode(ctx, result.code)
+	case <-ctx.Done():
+		return nil, errors.Errorf("login timed out, no authorization received on %s", redirectURI)
+	}
+}
+
+// handleLoginCommand logs in on the open platform of the url, which is
+// Feishu unless the api_domain of the config or a larksuite.com url tells
+// otherwise, the same as the client of the downloads.
+func handleLoginCommand(url string) error {
+	configPath, err := core.GetConfigFilePath()
+	if err != nil {
+		return err
+	}
+	config, err := core.ReadConfigFromFile(configPath)
+	if err != nil {
+		return err
+	}
+	tokenPath, err := core.GetTokenFilePath()
+	if err != nil {
+		return err
+	}
+
+	// a previous login may be for another open platform
+	opts, err := clientOptions(config, core.ResolveBaseURL(config.Feishu.ApiDomain, url))
+	if err != nil {
+		return err
+	}
+	client := core.NewClient(config.Feishu.AppId, config.Feishu.AppSecret, opts...)
+	addr := fmt.Sprintf("127.0.0.1:%d", loginOpts.port)
+	token, err := login(context.Background(), client, addr, func(authURL string) {
+		fmt.Println("Open the following url in the browser to login:")
+		fmt.Println(authURL)
+	})
+	if err != nil {
+		return err
+	}
+	if err = token.WriteToFile(tokenPath); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in as %s, token saved to %s\n", token.Name, tokenPath)
+	return nil
+}
+
+func handleLogoutCommand() error {
+	tokenPath, err := core.GetTokenFilePath()
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(tokenPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Println("Logged out, the app credentials are used from now on")
+	return nil
+}
+
+// newClient creates the client for the document url, which calls the APIs
+// as the logged in user if any, or as the app otherwise. The login is only
+// valid on the open platform it was made on.
+func newClient(config *core.Config, docURL string) (*core.Client, error) {
+	baseURL := core.ResolveBaseURL(config.Feishu.ApiDomain, docURL)
+	opts, err := clientOptions(config, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenPath, err := core.GetTokenFilePath()
+	if err != nil {
+		return nil, err
+	}
+	token, err := core.ReadUserTokenFromFile(tokenPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if token != nil {
+		if token.BaseURL != baseURL {
+			return nil, errors.Errorf("the login of %s is not for %s, please run `feishu2md login %s` again or `feishu2md logout`",
+				token.Name, baseURL, docURL)
+		}
+		opts = append(opts, core.WithUserToken(token, func(t *core.UserToken) error {
+			return t.WriteToFile(tokenPath)
+		}))
+	}
+
+	return core.NewClient(config.Feishu.AppId, config.Feishu.AppSecret, opts...), nil
+}
+
+// clientOptions returns the options of the clients of the app on baseURL
+func clientOptions(config *core.Config, baseURL string) ([]core.ClientOption, error) {
+	httpClient, err := core.NewHTTPClient(config.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	return []core.ClientOption{
+		core.WithBaseURL(baseURL),
+		core.WithRateLimit(config.Feishu.RateLimit, config.Feishu.RateBurst),
+		core.WithHTTPClient(httpClient),
+	}, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/core/fakefeishu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogin(t *testing.T) {
+	_, client := newFakeClient(t)
+
+	token, err := login(context.Background(), client, "127.0.0.1:0", func(authURL string) {
+		// act as the browser redirected by the authorization page
+		u, err := url.Parse(authURL)
+		assert.NoError(t, err)
+		query := u.Query()
+		redirect, err := url.Parse(query.Get("redirect_uri"))
+		assert.NoError(t, err)
+
+		bad := *redirect
+		bad.RawQuery = url.Values{"code": {fakefeishu.AuthorizationCode}, "state": {"forged"}}.Encode()
+		resp, err := http.Get(bad.String())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		redirect.RawQuery = url.Values{"code": {fakefeishu.AuthorizationCode}, "state": {query.Get("state")}}.Encode()
+		resp, err = http.Get(redirect.String())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, fakefeishu.UserName, token.Name)
+	assert.NotEmpty(t, token.RefreshToken)
+}
+
+func TestLoginDenied(t *testing.T) {
+	_, client := newFakeClient(t)
+
+	start := time.Now()
+	_, err := login(context.Background(), client, "127.0.0.1:0", func(authURL string) {
+		u, err := url.Parse(authURL)
+		assert.NoError(t, err)
+		query := u.Query()
+		redirect, err := url.Parse(query.Get("redirect_uri"))
+		assert.NoError(t, err)
+
+		redirect.RawQuery = url.Values{"error": {"access_denied"}, "state": {query.Get("state")}}.Encode()
+		resp, err := http.Get(redirect.String())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+	assert.ErrorContains(t, err, "access_denied")
+	assert.Less(t, time.Since(start), loginTimeout)
+}
+
+func TestNewClientLoginBaseURL(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tokenPath, err := core.GetTokenFilePath()
+	assert.NoError(t, err)
+	token := &core.UserToken{
+		Name:             fakefeishu.UserName,
+		BaseURL:          core.ResolveBaseURL("", "https://sample.feishu.cn"),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RefreshExpiresAt: time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, token.WriteToFile(tokenPath))
+	config := core.NewConfig("cli_fake", "secret")
+
+	_, err = newClient(config, "https://sample.feishu.cn/docx/docxtoken")
+	assert.NoError(t, err)
+
+	// the login on Feishu is not valid on Lark
+	_, err = newClient(config, "https://sample.larksuite.com/docx/docxtoken")
+	assert.ErrorContains(t, err, "feishu2md login https://sample.larksuite.com/docx/docxtoken")
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Wsine/feishu2md/core"
 	"github.com/urfave/cli/v2"
 )
 
@@ -36,16 +37,45 @@ func main() {
 						Usage:       "Set app secret for the OPEN API",
 						Destination: &configOpts.appSecret,
 					},
+					&cli.StringFlag{
+						Name:        "apiDomain",
+						Value:       "",
+						Usage:       "Set domain of the OPEN API for private deployments",
+						Destination: &configOpts.apiDomain,
+					},
 				},
 				Action: func(ctx *cli.Context) error {
 					return handleConfigCommand()
 				},
 			},
+			{
+				Name:      "login",
+				Usage:     "Login with your Feishu account to download the documents you can access",
+				ArgsUsage: "[url]",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:        "port",
+						Value:       9999,
+						Usage:       "Specify the port of the local redirect URL",
+						Destination: &loginOpts.port,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return handleLoginCommand(ctx.Args().First())
+				},
+			},
+			{
+				Name:  "logout",
+				Usage: "Remove the saved login and use the app credentials",
+				Action: func(ctx *cli.Context) error {
+					return handleLogoutCommand()
+				},
+			},
 			{
 				Name:    "download",
 				Aliases: []string{"dl"},
 				Usage:   "Download feishu/larksuite document to markdown file",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:        "output",
 						Aliases:     []string{"o"},
@@ -71,7 +101,38 @@ func main() {
 						Usage:       "Download all documents within the wiki.",
 						Destination: &dlOpts.wiki,
 					},
-				},
+					&cli.BoolFlag{
+						Name:        "recursive",
+						Aliases:     []string{"r"},
+						Value:       false,
+						Usage:       "Download the wiki node and all nodes below it",
+						Destination: &dlOpts.recursive,
+					},
+					&cli.BoolFlag{
+						Name:        "tasks-index",
+						Value:       false,
+						Usage:       "Collect the action items of all documents into tasks.md",
+						Destination: &dlOpts.tasksIndex,
+					},
+					&cli.BoolFlag{
+						Name:        "no-cache",
+						Value:       false,
+						Usage:       "Download the blocks of all documents ignoring the cache",
+						Destination: &dlOpts.noCache,
+					},
+					&cli.BoolFlag{
+						Name:        "dry-run",
+						Value:       false,
+						Usage:       "Print the tree of the documents to download and their paths without downloading",
+						Destination: &dlOpts.dryRun,
+					},
+					&cli.BoolFlag{
+						Name:        "json",
+						Value:       false,
+						Usage:       "Print the tree of --dry-run as json",
+						Destination: &dlOpts.json,
+					},
+				}, append(rateFlags(), walkFlags()...)...),
 				ArgsUsage: "<url>",
 				Action: func(ctx *cli.Context) error {
 					if ctx.NArg() == 0 {
@@ -82,10 +143,201 @@ func main() {
 					}
 				},
 			},
+			{
+				Name:  "sync",
+				Usage: "Mirror a folder or wiki space, only downloading the changed documents",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:        "keep-deleted",
+						Value:       false,
+						Usage:       "Keep the files of the documents removed upstream",
+						Destination: &syncOpts.keepDeleted,
+					},
+				}, append(rateFlags(), walkFlags()...)...),
+				ArgsUsage: "<url> <dir>",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 2 {
+						return cli.Exit("Please specify the folder/wiki url and the output directory", 1)
+					}
+					return handleSyncCommand(ctx.Args().Get(0), ctx.Args().Get(1))
+				},
+			},
+			{
+				Name:  "ls",
+				Usage: "List the documents of a folder or wiki space and their output paths",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Value:       "./",
+						Usage:       "Specify the output directory to plan the paths in",
+						Destination: &dlOpts.outputDir,
+					},
+					&cli.BoolFlag{
+						Name:        "json",
+						Value:       false,
+						Usage:       "Print the documents as json",
+						Destination: &dlOpts.json,
+					},
+				}, walkFlags()...),
+				ArgsUsage: "<url>",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() == 0 {
+						return cli.Exit("Please specify the folder/wiki url", 1)
+					}
+					return handleLsCommand(ctx.Args().First())
+				},
+			},
+			{
+				Name:  "convert",
+				Usage: "Convert the json dumped by download --dump to markdown file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Value:       "./",
+						Usage:       "Specify the output directory for the markdown files",
+						Destination: &convertOpts.outputDir,
+					},
+					&cli.BoolFlag{
+						Name:        "title-as-filename",
+						Usage:       "Name the markdown file by the document title",
+						Destination: &convertOpts.titleAsFilename,
+					},
+					&cli.BoolFlag{
+						Name:        "use-html-tags",
+						Usage:       "Render the text styles with html tags",
+						Destination: &convertOpts.useHTMLTags,
+					},
+					&cli.StringFlag{
+						Name:        "math-dialect",
+						Usage:       "Render the equations as dollar, latex, gitlab or mathml",
+						Destination: &convertOpts.mathDialect,
+					},
+					&cli.BoolFlag{
+						Name:        "toc",
+						Usage:       "Insert a table of contents after the title",
+						Destination: &convertOpts.toc,
+					},
+					&cli.StringFlag{
+						Name:        "slug-style",
+						Usage:       "Generate the heading anchors as github, gitlab, hugo or docusaurus",
+						Destination: &convertOpts.slugStyle,
+					},
+					&cli.StringFlag{
+						Name:        "comment-style",
+						Usage:       "Render the comments of a dump as footnote or appendix",
+						Destination: &convertOpts.commentStyle,
+					},
+					&cli.StringSliceFlag{
+						Name:        "code-language-map",
+						Usage:       "Map a code language by name or enum to another, e.g. shell=console",
+						Destination: &convertOpts.codeLanguageMap,
+					},
+				},
+				ArgsUsage: "<file.json>...",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() == 0 {
+						return cli.Exit("Please specify the json file(s) dumped by download --dump", 1)
+					}
+					return handleConvertCommand(ctx.Args().Slice(), ctx.IsSet)
+				},
+			},
 		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
+		if hint := core.ErrorHint(err); hint != "" {
+			log.Fatalf("%v\n%s", err, hint)
+		}
 		log.Fatal(err)
 	}
 }
+
+// rateFlags are the flags of the API quota shared by the download and sync
+// commands
+func rateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.Float64Flag{
+			Name:        "rate-limit",
+			Usage:       "Limit the API requests per second (default: rate_limit of the config)",
+			Destination: &dlOpts.rateLimit,
+		},
+		&cli.IntFlag{
+			Name:        "rate-burst",
+			Usage:       "Allow bursts of API requests (default: rate_burst of the config)",
+			Destination: &dlOpts.rateBurst,
+		},
+		&cli.IntFlag{
+			Name:        "workers",
+			Usage:       "Limit the concurrent API calls (default: workers of the config)",
+			Destination: &dlOpts.workers,
+		},
+	}
+}
+
+// walkFlags are the flags of the folder and wiki walks shared by the
+// download, sync and ls commands
+func walkFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "wiki-layout",
+			Value:       "sibling",
+			Usage:       "Place the content of a wiki node with children as sibling (Title.md), index (Title/index.md), _index (Title/_index.md) or readme (Title/README.md)",
+			Destination: &dlOpts.wikiLayout,
+		},
+		&cli.StringFlag{
+			Name:        "sheets",
+			Usage:       "Export the sheets of a folder or wiki as csv or xlsx",
+			Destination: &dlOpts.sheetFormat,
+		},
+		&cli.BoolFlag{
+			Name:        "bitables",
+			Value:       false,
+			Usage:       "Export the bitables of a folder or wiki as csv",
+			Destination: &dlOpts.bitables,
+		},
+		&cli.BoolFlag{
+			Name:        "files",
+			Value:       false,
+			Usage:       "Download the uploaded files of a folder or wiki as-is",
+			Destination: &dlOpts.files,
+		},
+		&cli.BoolFlag{
+			Name:        "shortcuts",
+			Value:       false,
+			Usage:       "Download the targets of the shortcuts in a folder",
+			Destination: &dlOpts.shortcuts,
+		},
+		&cli.IntFlag{
+			Name:        "max-depth",
+			Usage:       "Limit the depth of the folders to walk through, 1 for the given folder only, 0 for no limit",
+			Destination: &dlOpts.maxDepth,
+		},
+		&cli.StringSliceFlag{
+			Name:        "include",
+			Usage:       "Only download the documents whose title or path, or that of a parent, matches the glob or /regexp/",
+			Destination: &dlOpts.includes,
+		},
+		&cli.StringSliceFlag{
+			Name:        "exclude",
+			Usage:       "Skip the documents and folders whose title or path matches the glob or /regexp/",
+			Destination: &dlOpts.excludes,
+		},
+		&cli.StringFlag{
+			Name:        "modified-since",
+			Usage:       "Only download the documents modified since the date, e.g. 2024-01-31",
+			Destination: &dlOpts.modified,
+		},
+		&cli.StringFlag{
+			Name:        "owner",
+			Usage:       "Only download the documents owned by the user of the open id",
+			Destination: &dlOpts.owner,
+		},
+		&cli.StringFlag{
+			Name:        "path-template",
+			Usage:       "Name the output files by a template like '{{.Path}}/{{.Title}}-{{.Token | short}}.md' (default: path_template of the config)",
+			Destination: &dlOpts.pathTmpl,
+		},
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+const manifestName = "feishu2md.manifest.json"
+
+// manifest records the exported documents of a batch, wiki or sync
+// download in the output directory, including the failed ones, so that
+// a sync only downloads the documents whose revision changed. The paths
+// are relative to the output directory.
+type manifest struct {
+	mu   sync.Mutex
+	dir  string
+	prev map[string]*manifestEntry
+	docs map[string]*manifestEntry
+}
+
+type manifestFile struct {
+	Documents map[string]*manifestEntry `json:"documents"`
+}
+
+type manifestEntry struct {
+	Type       string                   `json:"type,omitempty"`
+	Title      string                   `json:"title"`
+	URL        string                   `json:"url"`
+	NodePath   string                   `json:"node_path,omitempty"`
+	RevisionID int64                    `json:"revision_id"`
+	Path       string                   `json:"path,omitempty"`
+	Images     map[string]manifestImage `json:"images,omitempty"`
+	Anchors    map[string]string        `json:"anchors,omitempty"`
+	Files      []string                 `json:"files,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+type manifestImage struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// dlManifest is only set during a batch, wiki or sync download
+var dlManifest *manifest
+
+func newManifest(dir string) *manifest {
+	return &manifest{
+		dir:  dir,
+		prev: make(map[string]*manifestEntry),
+		docs: make(map[string]*manifestEntry),
+	}
+}
+
+// readManifest reads the manifest of the last sync in dir, if any
+func readManifest(dir string) (*manifest, error) {
+	m := newManifest(dir)
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	file := manifestFile{}
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", manifestName, err)
+	}
+	for docToken, entry := range file.Documents {
+		m.prev[docToken] = entry
+	}
+	return m, nil
+}
+
+func (m *manifest) rel(path string) string {
+	rel, err := filepath.Rel(m.dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (m *manifest) abs(rel string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(rel))
+}
+
+// synced tells whether the document was exported by the last sync. It is
+// safe to call on a nil manifest.
+func (m *manifest) synced(docToken string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev, ok := m.prev[docToken]
+	return ok && prev.Path != ""
+}
+
+// reuse keeps the file of the document if its revision is unchanged since
+// the last sync, and moves it to outputPath with its images if the document
+// was renamed or moved.
+func (m *manifest) reuse(docToken string, entry *manifestEntry, outputPath string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev, ok := m.prev[docToken]
+	if !ok || prev.Path == "" || prev.RevisionID != entry.RevisionID {
+		return false, nil
+	}
+	oldPath := m.abs(prev.Path)
+	if _, err := os.Stat(oldPath); err != nil {
+		return false, nil
+	}
+	entry.Path, entry.Images, entry.Anchors = prev.Path, prev.Images, prev.Anchors
+	if rel := m.rel(outputPath); rel != prev.Path {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+			return false, err
+		}
+		if err := os.Rename(oldPath, outputPath); err != nil {
+			return false, err
+		}
+		fmt.Printf("Moved markdown file %s to %s\n", oldPath, outputPath)
+		entry.Path = rel
+		if err := m.moveImages(entry, oldPath, outputPath); err != nil {
+			return false, err
+		}
+	} else {
+		fmt.Printf("Unchanged markdown file %s\n", outputPath)
+	}
+	m.docs[docToken] = entry
+	return true, nil
+}
+
+// moveImages copies the images below the folder of a moved document to
+// the same place below its new folder, and links them in the markdown. The
+// images at the old paths are deleted by finish unless another document
+// still has them.
+func (m *manifest) moveImages(entry *manifestEntry, oldPath, outputPath string) error {
+	images := make(map[string]manifestImage)
+	var links []string
+	for imgToken, img := range entry.Images {
+		images[imgToken] = img
+		oldLink := m.abs(img.Path)
+		rel, err := filepath.Rel(filepath.Dir(oldPath), oldLink)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		newLink := filepath.Join(filepath.Dir(outputPath), rel)
+		data, err := os.ReadFile(oldLink)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(newLink), 0o755); err != nil {
+			return err
+		}
+		if err = os.WriteFile(newLink, data, 0o644); err != nil {
+			return err
+		}
+		img.Path = m.rel(newLink)
+		images[imgToken] = img
+		links = append(links, oldLink, newLink)
+	}
+	entry.Images = images
+	if len(links) == 0 {
+		return nil
+	}
+	markdown, err := os.ReadFile(outputPath)
+	if err != nil {
+		return err
+	}
+	result := strings.NewReplacer(links...).Replace(string(markdown))
+	return os.WriteFile(outputPath, []byte(result), 0o644)
+}
+
+// add records a downloaded document with its images by token
+func (m *manifest) add(docToken string, entry *manifestEntry, outputPath string, localLinks map[string]string) error {
+	entry.Path = m.rel(outputPath)
+	for imgToken, localLink := range localLinks {
+		data, err := os.ReadFile(localLink)
+		if err != nil {
+			return err
+		}
+		if entry.Images == nil {
+			entry.Images = make(map[string]manifestImage)
+		}
+		sum := sha256.Sum256(data)
+		entry.Images[imgToken] = manifestImage{
+			Path:   m.rel(localLink),
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.docs[docToken] = entry
+	return nil
+}
+
+// addFiles records an object exported to the files, the first one being
+// its main output. It is safe to call on a nil manifest.
+func (m *manifest) addFiles(token string, entry *manifestEntry, outputPaths []string) {
+	if m == nil {
+		return
+	}
+	for i, outputPath := range outputPaths {
+		if i == 0 {
+			entry.Path = m.rel(outputPath)
+		} else {
+			entry.Files = append(entry.Files, m.rel(outputPath))
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.docs[token] = entry
+}
+
+// fail records a document failed to download. The files of its last sync
+// are kept. It is safe to call on a nil manifest.
+func (m *manifest) fail(docToken string, entry *manifestEntry, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prev, ok := m.prev[docToken]; ok {
+		entry.RevisionID, entry.Path, entry.Images = prev.RevisionID, prev.Path, prev.Images
+		entry.Anchors = prev.Anchors
+		entry.Files = prev.Files
+	}
+	entry.Error = err.Error()
+	m.docs[docToken] = entry
+}
+
+// image returns the local link of an image of the last sync, if the file is
+// still intact. It is safe to call on a nil manifest.
+func (m *manifest) image(imgToken string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.prev {
+		img, ok := entry.Images[imgToken]
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(m.abs(img.Path))
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) == img.SHA256 {
+			return m.abs(img.Path), true
+		}
+	}
+	return "", false
+}
+
+// finish deletes the files of the last sync that are no longer exported,
+// unless keepDeleted keeps the documents removed upstream, then saves the
+// manifest.
+func (m *manifest) finish(keepDeleted bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if keepDeleted {
+		for docToken, entry := range m.prev {
+			if _, ok := m.docs[docToken]; !ok {
+				m.docs[docToken] = entry
+			}
+		}
+	}
+
+	live := make(map[string]bool)
+	for _, entry := range m.docs {
+		for _, path := range entry.paths() {
+			live[path] = true
+		}
+	}
+	var stale []string
+	for _, entry := range m.prev {
+		for _, path := range entry.paths() {
+			if !live[path] {
+				stale = append(stale, path)
+				live[path] = true
+			}
+		}
+	}
+	sort.Strings(stale)
+	for _, path := range stale {
+		err := os.Remove(m.abs(path))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", m.abs(path))
+		m.removeEmptyDirs(filepath.Dir(m.abs(path)))
+	}
+	return m.save()
+}
+
+// write saves the manifest of a batch or wiki download
+func (m *manifest) write() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.save()
+}
+
+func (m *manifest) save() error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	outputPath := filepath.Join(m.dir, manifestName)
+	pdata := utils.PrettyPrint(manifestFile{Documents: m.docs})
+	if err := os.WriteFile(outputPath, []byte(pdata), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote manifest to %s\n", outputPath)
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents up to the output directory
+// while they are empty
+func (m *manifest) removeEmptyDirs(dir string) {
+	for rel := m.rel(dir); rel != "." && !strings.HasPrefix(rel, ".."); rel = m.rel(dir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (e *manifestEntry) paths() []string {
+	var paths []string
+	if e.Path != "" {
+		paths = append(paths, e.Path)
+	}
+	for _, img := range e.Images {
+		paths = append(paths, img.Path)
+	}
+	paths = append(paths, e.Files...)
+	return paths
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// The formats to export the sheets
+const (
+	SheetFormatCSV  = "csv"
+	SheetFormatXLSX = "xlsx"
+)
+
+var urlPrefixRegexp = regexp.MustCompile(`^https://[\w-.]+`)
+
+// objectURLPaths maps the object types to the paths of their urls
+var objectURLPaths = map[string]string{
+	"sheet":   "sheets",
+	"bitable": "base",
+	"folder":  "drive/folder",
+}
+
+// shortcutTargetURL returns the url of the target of a drive shortcut
+func shortcutTargetURL(shortcutURL, targetType, targetToken string) string {
+	urlPath, ok := objectURLPaths[targetType]
+	if !ok {
+		urlPath = targetType
+	}
+	return fmt.Sprintf("%s/%s/%s", urlPrefixRegexp.FindString(shortcutURL), urlPath, targetToken)
+}
+
+// fileTarget returns the type and token of a file of a folder, which are
+// those of the target for a shortcut
+func fileTarget(file *lark.GetDriveFileListRespFile) (string, string) {
+	if file.Type == "shortcut" && file.ShortcutInfo != nil {
+		return file.ShortcutInfo.TargetType, file.ShortcutInfo.TargetToken
+	}
+	return file.Type, file.Token
+}
+
+// objectEnabled tells whether the objects of the type are exported
+func objectEnabled(objType string) bool {
+	switch objType {
+	case "sheet":
+		return dlOpts.sheetFormat != ""
+	case "bitable":
+		return dlOpts.bitables
+	case "file":
+		return dlOpts.files
+	}
+	return false
+}
+
+// warnSkipped tells about the objects of a folder or wiki that can't be
+// exported, which are the mindnotes lacking an API to read their content
+func warnSkipped(objType string, nodePath titlePath) {
+	if objType == "mindnote" && dlPlan == nil {
+		fmt.Printf("Skipped mindnote %s, its content can't be read by the open API\n", nodePath)
+	}
+}
+
+// downloadObject exports a sheet, a bitable or an uploaded file of a folder
+// or wiki to item.outputPath, or else into item.outputDir
+func downloadObject(ctx context.Context, client core.DocSource, objType, token, title, url string, item *walkItem) (err error) {
+	entry := &manifestEntry{Type: objType, Title: title, URL: url, NodePath: item.nodePath.String()}
+	defer func() {
+		if err != nil {
+			dlManifest.fail(token, entry, err)
+		}
+	}()
+	objectPath := item.outputPath
+	if objectPath == "" {
+		objectPath, err = item.objectPath(&pathData{Title: title, Token: token, Type: objType})
+		if err != nil {
+			return err
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return err
+	}
+	// a spreadsheet or bitable of several tables is exported into a folder
+	basePath := strings.TrimSuffix(objectPath, filepath.Ext(objectPath))
+
+	var outputPaths []string
+	claims := newPathClaims()
+	switch objType {
+	case "sheet":
+		if dlOpts.sheetFormat == SheetFormatXLSX {
+			var data []byte
+			err = dlPool.Do(func() (err error) {
+				_, data, err = client.ExportFile(ctx, token, objType, SheetFormatXLSX)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ExportFile err: %w for %v", err, url)
+			}
+			outputPath := basePath + ".xlsx"
+			if err = os.WriteFile(outputPath, data, 0o644); err != nil {
+				return err
+			}
+			outputPaths = append(outputPaths, outputPath)
+			break
+		}
+		var sheets []*core.Sheet
+		err = dlPool.Do(func() (err error) {
+			sheets, err = client.GetSheets(ctx, token)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("GetSheets err: %w for %v", err, url)
+		}
+		for _, sheet := range sheets {
+			outputPath := basePath + ".csv"
+			if len(sheets) > 1 {
+				outputPath = claims.claim(filepath.Join(basePath, utils.SanitizeFileName(sheet.Title)+".csv"), false)
+			}
+			if err = writeCSV(outputPath, sheet.Values); err != nil {
+				return err
+			}
+			outputPaths = append(outputPaths, outputPath)
+		}
+	case "bitable":
+		var tables []*core.BitableTable
+		err = dlPool.Do(func() (err error) {
+			tables, err = client.GetBitableTables(ctx, token)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("GetBitableTables err: %w for %v", err, url)
+		}
+		for _, table := range tables {
+			outputPath := basePath + ".csv"
+			if len(tables) > 1 {
+				outputPath = claims.claim(filepath.Join(basePath, utils.SanitizeFileName(table.Name)+".csv"), false)
+			}
+			rows := append([][]string{table.Fields}, table.Records...)
+			if err = writeCSV(outputPath, rows); err != nil {
+				return err
+			}
+			outputPaths = append(outputPaths, outputPath)
+		}
+	case "file":
+		var data []byte
+		err = dlPool.Do(func() (err error) {
+			_, data, err = client.DownloadFile(ctx, token)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("DownloadFile err: %w for %v", err, url)
+		}
+		if err = os.WriteFile(objectPath, data, 0o644); err != nil {
+			return err
+		}
+		outputPaths = append(outputPaths, objectPath)
+	default:
+		return errors.Errorf("Unsupported object type %s", objType)
+	}
+
+	for _, outputPath := range outputPaths {
+		fmt.Printf("Downloaded %s file to %s\n", objType, outputPath)
+	}
+	dlManifest.addFiles(token, entry, outputPaths)
+	return nil
+}
+
+func writeCSV(outputPath string, rows [][]string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	if err = w.WriteAll(rows); err != nil {
+		return err
+	}
+	return file.Close()
+}
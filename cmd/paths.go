@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+// pathData are the fields of a document or object for the path template,
+// e.g. {{.Path}}/{{.Title}}-{{.Token | short}}.md
+type pathData struct {
+	Path     string    // folder of the node below the export root, sanitized
+	Title    string    // title, without extension for an uploaded file
+	Token    string    // token of the document or object
+	Type     string    // docx, sheet, bitable or file
+	Created  time.Time // zero when unknown
+	Modified time.Time // zero when unknown
+}
+
+var pathFuncs = template.FuncMap{
+	// short keeps the last 8 characters of a token
+	"short": func(token string) string {
+		if len(token) > 8 {
+			return token[len(token)-8:]
+		}
+		return token
+	},
+	"slugify": func(s string) string {
+		return utils.Slugify(s, utils.SlugStyleGitHub)
+	},
+	"pinyin": utils.Pinyin,
+	"lower":  strings.ToLower,
+	// date formats a time by the layout of Go, e.g. {{.Modified | date "2006-01"}}
+	"date": func(layout string, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(layout)
+	},
+}
+
+// dlTemplate is the path template of the downloads, if any
+var dlTemplate *template.Template
+
+// parsePathTemplate parses and tries the path template, nil if empty
+func parsePathTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("path").Funcs(pathFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template: %w", err)
+	}
+	if err = tmpl.Execute(new(strings.Builder), &pathData{}); err != nil {
+		return nil, fmt.Errorf("invalid path template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// objectExt returns the extension of the main output of a document or
+// object of the type
+func objectExt(objType, title string) string {
+	switch objType {
+	case "sheet":
+		if dlOpts.sheetFormat != "" {
+			return "." + dlOpts.sheetFormat
+		}
+	case "bitable":
+		return ".csv"
+	case "file":
+		return filepath.Ext(title)
+	}
+	return ".md"
+}
+
+// templateNeedsTimes tells whether the path template names by the created
+// or modified times, which the folder lists lack
+func templateNeedsTimes() bool {
+	if dlTemplate == nil {
+		return false
+	}
+	text := dlTemplate.Tree.Root.String()
+	return strings.Contains(text, ".Created") || strings.Contains(text, ".Modified")
+}
+
+// renderPath returns the slash separated path of a document or object below
+// the export root: the rendered template, or by default the file named by
+// the title or token in data.Path. The extension is always that of the
+// type, and every part of the path is sanitized.
+func renderPath(tmpl *template.Template, titleAsFilename bool, _data *pathData) (string, error) {
+	data := *_data
+	ext := objectExt(data.Type, data.Title)
+	if data.Type == "file" {
+		data.Title = strings.TrimSuffix(data.Title, ext)
+	}
+	data.Title = strings.NewReplacer("/", "_", "\\", "_").Replace(data.Title)
+
+	var rendered string
+	if tmpl != nil {
+		buf := new(strings.Builder)
+		if err := tmpl.Execute(buf, &data); err != nil {
+			return "", fmt.Errorf("path template err: %w for %s", err, data.Token)
+		}
+		rendered = strings.TrimSuffix(buf.String(), ".md")
+	} else if titleAsFilename {
+		rendered = path.Join(data.Path, data.Title)
+	} else {
+		rendered = path.Join(data.Path, data.Token)
+	}
+
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(rendered), "/") {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{data.Token}
+	}
+	parts[len(parts)-1] += ext
+	for i, part := range parts {
+		parts[i] = utils.SanitizeFileName(part)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// walkItem is a document or object to download, with its place in the
+// folder or wiki walked through. A single document only has its outputDir.
+type walkItem struct {
+	nodePath   titlePath
+	outputDir  string
+	fileName   string
+	outputPath string
+	pathRoot   string
+	pathClaims *pathClaims
+	pathData   *pathData
+}
+
+// objectPath returns the output path of a document or object of the
+// folder item.outputDir below item.pathRoot, claimed in item.pathClaims if
+// any. The wiki layouts keep their file name.
+func (item *walkItem) objectPath(data *pathData) (string, error) {
+	root := item.pathRoot
+	if root == "" {
+		root = item.outputDir
+	}
+	if rel, err := filepath.Rel(root, item.outputDir); err == nil && rel != "." {
+		data.Path = filepath.ToSlash(rel)
+	}
+	rel, err := renderPath(dlTemplate, dlConfig.Output.TitleAsFilename, data)
+	if err != nil {
+		return "", err
+	}
+	if item.fileName != "" {
+		rel = path.Join(path.Dir(rel), item.fileName)
+	}
+	return item.pathClaims.claim(filepath.Join(root, filepath.FromSlash(rel)), false), nil
+}
+
+// pathClaims de-duplicates the paths of the files and folders of a walk
+// by appending -1, -2... like the slugs of headings. The paths are compared
+// ignoring case, as on the file systems of Windows and macOS.
+type pathClaims struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+}
+
+func newPathClaims() *pathClaims {
+	return &pathClaims{claimed: make(map[string]bool)}
+}
+
+// claim returns p, or the first free variant of it. It is safe to call on a
+// nil claims, which leaves p as is.
+func (c *pathClaims) claim(p string, dir bool) string {
+	if c == nil {
+		return p
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ext := ""
+	if !dir {
+		ext = filepath.Ext(p)
+	}
+	stem := strings.TrimSuffix(p, ext)
+	claimed := p
+	for i := 1; c.claimed[strings.ToLower(claimed)]; i++ {
+		claimed = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	c.claimed[strings.ToLower(claimed)] = true
+	return claimed
+}
+
+// release frees p to be claimed again. It is safe to call on a nil claims.
+func (c *pathClaims) release(p string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.claimed, strings.ToLower(p))
+}
+
+// folderPath returns the de-duplicated path of a folder or wiki node with
+// children named title in parent
+func (c *pathClaims) folderPath(parent, title string) string {
+	return c.claim(filepath.Join(parent, utils.SanitizeFileName(title)), true)
+}
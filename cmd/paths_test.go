@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPath(t *testing.T) {
+	setupDownload(t)
+	data := &pathData{Path: "Guides", Title: "Q1: 计划/草稿", Token: "doxcnFakeInstallGuide00001",
+		Type: "docx", Modified: time.Date(2024, 3, 9, 0, 0, 0, 0, time.Local)}
+
+	p, err := renderPath(nil, false, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Guides/doxcnFakeInstallGuide00001.md", p)
+	p, err = renderPath(nil, true, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Guides/Q1_ 计划_草稿.md", p)
+	assert.Equal(t, "Q1: 计划/草稿", data.Title)
+
+	for _, tc := range []struct {
+		text string
+		want string
+	}{
+		{`{{.Path}}/{{.Title}}-{{.Token | short}}.md`, "Guides/Q1_ 计划_草稿-ide00001.md"},
+		{`{{.Modified | date "2006/01"}}/{{.Title | slugify}}`, "2024/03/q1-计划_草稿.md"},
+		{`{{.Path | lower}}/{{.Title | pinyin}}`, "guides/Q1_ ji-hua-_-cao-gao.md"},
+		{`{{.Created | date "2006"}}/{{.Title}}`, "Q1_ 计划_草稿.md"},
+	} {
+		tmpl, err := parsePathTemplate(tc.text)
+		assert.NoError(t, err)
+		p, err := renderPath(tmpl, false, data)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, p, tc.text)
+	}
+
+	p, err = renderPath(nil, true, &pathData{Title: "report.final.pdf", Token: "boxcnFake", Type: "file"})
+	assert.NoError(t, err)
+	assert.Equal(t, "report.final.pdf", p)
+
+	_, err = parsePathTemplate(`{{.Owner}}`)
+	assert.Error(t, err)
+	_, err = parsePathTemplate(`{{.Title`)
+	assert.Error(t, err)
+}
+
+func TestPathClaims(t *testing.T) {
+	claims := newPathClaims()
+	assert.Equal(t, "out/FAQ.md", claims.claim("out/FAQ.md", false))
+	assert.Equal(t, "out/faq-1.md", claims.claim("out/faq.md", false))
+	assert.Equal(t, "out/FAQ-2.md", claims.claim("out/FAQ.md", false))
+	assert.Equal(t, "out/v1.2", claims.claim("out/v1.2", true))
+	assert.Equal(t, "out/v1.2-1", claims.claim("out/v1.2", true))
+	claims.release("out/FAQ.md")
+	assert.Equal(t, "out/FAQ.md", claims.claim("out/FAQ.md", false))
+
+	var nilClaims *pathClaims
+	assert.Equal(t, "out/FAQ.md", nilClaims.claim("out/FAQ.md", false))
+}
+
+func TestDownloadDocumentsDuplicates(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlConfig.Output.SkipImgDownload = true
+	source, docTokens := newTestSource(t)
+
+	// two documents of the same title in a folder
+	for _, docToken := range docTokens {
+		source.Documents[docToken].Document.Title = "Notes: Draft"
+	}
+	source.Folders["fldcnRoot"] = []*lark.GetDriveFileListRespFile{
+		{Token: docTokens[0], Name: "Notes: Draft", Type: "docx",
+			URL: "https://sample.feishu.cn/docx/" + docTokens[0]},
+		{Token: docTokens[1], Name: "Notes: Draft", Type: "docx",
+			URL: "https://sample.feishu.cn/docx/" + docTokens[1]},
+	}
+
+	err := downloadDocuments(context.Background(), source,
+		"https://sample.feishu.cn/drive/folder/fldcnRoot")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "Notes_ Draft.md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Notes_ Draft-1.md"))
+}
+
+func TestDownloadWikiSanitized(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.SkipImgDownload = true
+	source, docTokens := newTestSource(t)
+
+	source.WikiSpaces["7000"] = "Hand: book"
+	source.WikiNodes = []*lark.GetWikiNodeListRespItem{
+		{SpaceID: "7000", NodeToken: "wikcnParent", ObjToken: docTokens[0],
+			ObjType: "docx", Title: "Q1/Q2", HasChild: true},
+		{SpaceID: "7000", NodeToken: "wikcnChild", ObjToken: docTokens[1],
+			ObjType: "docx", Title: "Child", ParentNodeToken: "wikcnParent"},
+	}
+
+	err := downloadWiki(context.Background(), source,
+		"https://sample.feishu.cn/wiki/settings/7000")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "Hand_ book", docTokens[0]+".md"))
+	assert.FileExists(t, filepath.Join(outputDir, "Hand_ book", "Q1_Q2", docTokens[1]+".md"))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// planItem is a folder, node or document walked by a dry run, with the
+// path it would be downloaded to
+type planItem struct {
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+	Token     string `json:"token"`
+	NodeToken string `json:"node_token,omitempty"`
+	NodePath  string `json:"node_path"`
+	Path      string `json:"path,omitempty"`
+	// depth is the number of the parents, as the titles may contain slashes
+	depth int
+}
+
+// plan collects the items of a dry run in the order of the walk. The walk
+// lists the folders and wiki nodes without fetching any content.
+type plan struct {
+	items []*planItem
+}
+
+// dlPlan is only set during a dry run
+var dlPlan *plan
+
+// add appends an item. It is safe to call on a nil plan.
+func (p *plan) add(item *planItem) {
+	if p == nil {
+		return
+	}
+	p.items = append(p.items, item)
+}
+
+// print writes the items as a tree, or as json
+func (p *plan) print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		items := p.items
+		if items == nil {
+			items = []*planItem{}
+		}
+		_, err := fmt.Fprintln(w, utils.PrettyPrint(items))
+		return err
+	}
+	for _, item := range p.items {
+		indent := strings.Repeat("  ", item.depth)
+		line := fmt.Sprintf("%s%s [%s %s]", indent, item.Title, item.Type, item.Token)
+		if item.Path != "" {
+			line += " -> " + item.Path
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleLsCommand walks the folder, wiki space or wiki node of url like a
+// download would do, and prints what would be downloaded
+func handleLsCommand(url string) error {
+	_, _, wikiErr := utils.ValidateWikiURL(url)
+	_, _, nodeErr := utils.ValidateWikiNodeURL(url)
+	if wikiErr == nil {
+		dlOpts.wiki = true
+	} else if nodeErr == nil {
+		dlOpts.recursive = true
+	} else if _, folderErr := utils.ValidateFolderURL(url); folderErr == nil {
+		dlOpts.batch = true
+	} else if _, _, docErr := utils.ValidateDocumentURL(url); docErr != nil {
+		return errors.Errorf("Only the folder, wiki space, wiki node and document urls can be listed")
+	}
+	dlOpts.dryRun = true
+	return handleDownloadCommand(url)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanDocuments(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlOpts.sheetFormat = SheetFormatCSV
+	dlPlan = &plan{}
+	t.Cleanup(func() { dlPlan = nil })
+	server, client := newFakeClient(t)
+
+	err := downloadDocuments(context.Background(), client,
+		"https://sample.feishu.cn/drive/folder/fldcnFakeRoot")
+	assert.NoError(t, err)
+	for _, r := range server.Requests() {
+		assert.False(t, strings.Contains(r, "/docx/v1/documents/"), r)
+	}
+	assert.NoDirExists(t, filepath.Join(outputDir, "Guides"))
+
+	out := new(bytes.Buffer)
+	assert.NoError(t, dlPlan.print(out, false))
+	assert.Equal(t, strings.Join([]string{
+		"Guides [folder fldcnFakeGuides] -> " + filepath.Join(outputDir, "Guides"),
+		"  Install Guide [docx doxcnFakeInstallGuide00001] -> " + filepath.Join(outputDir, "Guides", "Install Guide.md"),
+		"  FAQ [docx doxcnFakeFaq0000000000001] -> " + filepath.Join(outputDir, "Guides", "FAQ.md"),
+		"Release Notes [docx doxcnFakeReleaseNotes000001] -> " + filepath.Join(outputDir, "Release Notes.md"),
+		"Budget [sheet shtcnFakeBudget] -> " + filepath.Join(outputDir, "Budget.csv"),
+		"",
+	}, "\n"), out.String())
+
+	out.Reset()
+	assert.NoError(t, dlPlan.print(out, true))
+	var items []*planItem
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &items))
+	assert.Len(t, items, 5)
+	assert.Equal(t, "Guides/FAQ", items[2].NodePath)
+}
+
+func TestPlanWiki(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlOpts.wikiLayout = WikiLayoutIndex
+	dlPlan = &plan{}
+	t.Cleanup(func() { dlPlan = nil })
+	_, client := newFakeClient(t)
+
+	err := downloadWiki(context.Background(), client,
+		"https://sample.feishu.cn/wiki/settings/7100000000000000001")
+	assert.NoError(t, err)
+	if assert.Len(t, dlPlan.items, 3) {
+		// the parent is listed before its children
+		assert.Equal(t, "wikcnFakeReleaseNotes", dlPlan.items[0].NodeToken)
+		assert.Equal(t, filepath.Join(outputDir, "Handbook", "Release Notes", "index.md"), dlPlan.items[0].Path)
+		assert.Equal(t, "Release Notes/Install Guide", dlPlan.items[1].NodePath)
+	}
+}
+
+func TestPlanWikiSlashTitle(t *testing.T) {
+	setupDownload(t)
+	dlPlan = &plan{}
+	t.Cleanup(func() { dlPlan = nil })
+	source, docTokens := newTestSource(t)
+
+	source.WikiSpaces["7000"] = "Handbook"
+	source.WikiNodes = []*lark.GetWikiNodeListRespItem{
+		{SpaceID: "7000", NodeToken: "wikcnParent", ObjToken: docTokens[0],
+			ObjType: "docx", Title: "Q1/Q2", HasChild: true},
+		{SpaceID: "7000", NodeToken: "wikcnChild", ObjToken: docTokens[1],
+			ObjType: "docx", Title: "Child", ParentNodeToken: "wikcnParent"},
+	}
+
+	err := downloadWiki(context.Background(), source,
+		"https://sample.feishu.cn/wiki/settings/7000")
+	assert.NoError(t, err)
+	out := new(bytes.Buffer)
+	assert.NoError(t, dlPlan.print(out, false))
+	lines := strings.Split(out.String(), "\n")
+	if assert.Len(t, lines, 3) {
+		// the slash of the title is no parent
+		assert.True(t, strings.HasPrefix(lines[0], "Q1/Q2 [docx "), lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], "  Child [docx "), lines[1])
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+// workerPool bounds the number of concurrent API calls of a download. It
+// is shared by the documents and their images, so that the export stays
+// under the API quota whatever its mode.
+type workerPool chan struct{}
+
+var dlPool workerPool
+
+func newWorkerPool(workers int) workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	return make(workerPool, workers)
+}
+
+// Do runs fn once a worker is free. A nil pool runs fn right away.
+func (p workerPool) Do(fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	p <- struct{}{}
+	defer func() { <-p }()
+	return fn()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+type SyncOpts struct {
+	keepDeleted bool
+}
+
+var syncOpts = SyncOpts{}
+
+// syncDocuments mirrors a folder or a wiki space into dir, downloading only
+// the documents changed since the last sync recorded in its manifest
+func syncDocuments(ctx context.Context, client core.DocSource, url, dir string) error {
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	dlManifest = m
+	defer func() { dlManifest = nil }()
+
+	dlOpts.outputDir = dir
+	_, _, wikiErr := utils.ValidateWikiURL(url)
+	_, _, nodeErr := utils.ValidateWikiNodeURL(url)
+	if wikiErr == nil || nodeErr == nil {
+		err = downloadWiki(ctx, client, url)
+	} else if _, folderErr := utils.ValidateFolderURL(url); folderErr == nil {
+		err = downloadDocuments(ctx, client, url)
+	} else {
+		return errors.Errorf("Only the folder, wiki space and wiki node urls can be synced")
+	}
+	if linkErr := m.rewriteLinks(); linkErr != nil && err == nil {
+		err = linkErr
+	}
+	if err != nil {
+		// keep the files of the documents not reached
+		if finishErr := m.finish(true); finishErr != nil {
+			return finishErr
+		}
+		return err
+	}
+	return m.finish(syncOpts.keepDeleted)
+}
+
+func handleSyncCommand(url, dir string) error {
+	// every document is checked against its revision before downloading
+	dlOpts.noCache = true
+	client, err := newDownloadSource(url)
+	if err != nil {
+		return err
+	}
+	return syncDocuments(context.Background(), client, url, dir)
+}
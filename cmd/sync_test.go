@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingSource counts the documents whose content is downloaded
+type countingSource struct {
+	*core.MemorySource
+	downloads int
+}
+
+func (s *countingSource) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	s.downloads++
+	return s.MemorySource.GetDocxContent(ctx, docToken)
+}
+
+func newSyncSource(t *testing.T) *countingSource {
+	source := core.NewMemorySource()
+	if err := source.LoadDir(filepath.Join(utils.RootDir(), "testdata", "fakefeishu")); err != nil {
+		t.Fatal(err)
+	}
+	return &countingSource{MemorySource: source}
+}
+
+func removeWikiNode(source *countingSource, nodeToken string) {
+	for i, n := range source.WikiNodes {
+		if n.NodeToken == nodeToken {
+			source.WikiNodes = append(source.WikiNodes[:i], source.WikiNodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestSyncWiki(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	syncOpts = SyncOpts{}
+	source := newSyncSource(t)
+	url := "https://sample.feishu.cn/wiki/settings/7100000000000000001"
+	wikiDir := filepath.Join(outputDir, "Handbook")
+
+	err := syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, source.downloads)
+	assert.FileExists(t, filepath.Join(wikiDir, "Release Notes.md"))
+	assert.FileExists(t, filepath.Join(wikiDir, "static", "boxcnFakeDiagram0000000001.png"))
+	assert.FileExists(t, filepath.Join(wikiDir, "Release Notes", "FAQ.md"))
+	assert.FileExists(t, filepath.Join(outputDir, manifestName))
+
+	// nothing changed
+	err = syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, source.downloads)
+
+	// a new revision of the FAQ, and its section is renamed
+	source.Documents["doxcnFakeFaq0000000000001"].Document.RevisionID++
+	source.WikiNodes[0].Title = "Changelog"
+	err = syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, source.downloads)
+	assert.FileExists(t, filepath.Join(wikiDir, "Changelog", "Install Guide.md"))
+	assert.FileExists(t, filepath.Join(wikiDir, "Changelog", "FAQ.md"))
+	assert.NoDirExists(t, filepath.Join(wikiDir, "Release Notes"))
+
+	// the install guide is removed upstream
+	removeWikiNode(source, "wikcnFakeInstallGuide")
+	err = syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, source.downloads)
+	assert.NoFileExists(t, filepath.Join(wikiDir, "Changelog", "Install Guide.md"))
+	assert.FileExists(t, filepath.Join(wikiDir, "Changelog", "FAQ.md"))
+	assert.FileExists(t, filepath.Join(wikiDir, "static", "boxcnFakeDiagram0000000001.png"))
+}
+
+func TestSyncKeepDeleted(t *testing.T) {
+	outputDir := setupDownload(t)
+	syncOpts = SyncOpts{keepDeleted: true}
+	source := newSyncSource(t)
+	url := "https://sample.feishu.cn/drive/folder/fldcnFakeRoot"
+
+	err := syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	guidePath := filepath.Join(outputDir, "Guides", "doxcnFakeInstallGuide00001.md")
+	assert.FileExists(t, guidePath)
+
+	source.Folders["fldcnFakeGuides"] = source.Folders["fldcnFakeGuides"][1:]
+	err = syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.FileExists(t, guidePath)
+
+	m, err := readManifest(outputDir)
+	assert.NoError(t, err)
+	assert.Contains(t, m.prev, "doxcnFakeInstallGuide00001")
+}
+
+func TestSyncMovesImages(t *testing.T) {
+	outputDir := setupDownload(t)
+	dlConfig.Output.TitleAsFilename = true
+	dlOpts.wikiLayout = WikiLayoutIndex
+	syncOpts = SyncOpts{}
+	source := newSyncSource(t)
+	url := "https://sample.feishu.cn/wiki/settings/7100000000000000001"
+	wikiDir := filepath.Join(outputDir, "Handbook")
+
+	err := syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	oldImage := filepath.Join(wikiDir, "Release Notes", "static", "boxcnFakeDiagram0000000001.png")
+	assert.FileExists(t, oldImage)
+
+	// the page with the image is renamed without a new revision
+	source.WikiNodes[0].Title = "Changelog"
+	err = syncDocuments(context.Background(), source, url, outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, source.downloads)
+	newImage := filepath.Join(wikiDir, "Changelog", "static", "boxcnFakeDiagram0000000001.png")
+	assert.FileExists(t, newImage)
+	assert.NoDirExists(t, filepath.Join(wikiDir, "Release Notes"))
+	markdown, err := os.ReadFile(filepath.Join(wikiDir, "Changelog", "index.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(markdown), newImage)
+	assert.NotContains(t, string(markdown), oldImage)
+
+	m, err := readManifest(outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, "Handbook/Changelog/static/boxcnFakeDiagram0000000001.png",
+		m.prev["doxcnFakeReleaseNotes000001"].Images["boxcnFakeDiagram0000000001"].Path)
+}
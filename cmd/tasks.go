@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+)
+
+// taskIndex collects the action items of all downloaded documents
+type taskIndex struct {
+	mu      sync.Mutex
+	entries []taskIndexEntry
+}
+
+type taskIndexEntry struct {
+	title string
+	path  string
+	todos []*core.TodoItem
+}
+
+var dlTasks = taskIndex{}
+
+func (t *taskIndex) add(title, path string, todos []*core.TodoItem) {
+	if len(todos) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, taskIndexEntry{title: title, path: path, todos: todos})
+}
+
+// write saves the action items as tasks.md with links relative to outputDir
+func (t *taskIndex) write(outputDir string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sort.Slice(t.entries, func(i, j int) bool {
+		return t.entries[i].path < t.entries[j].path
+	})
+
+	buf := new(strings.Builder)
+	buf.WriteString("# Tasks\n")
+	for _, entry := range t.entries {
+		link, err := filepath.Rel(outputDir, entry.path)
+		if err != nil {
+			link = entry.path
+		}
+		buf.WriteString(fmt.Sprintf("\n## [%s](<%s>)\n\n", entry.title, filepath.ToSlash(link)))
+		for _, todo := range entry.todos {
+			buf.WriteString(todo.Markdown() + "\n")
+		}
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return err
+	}
+	outputPath := filepath.Join(outputDir, "tasks.md")
+	if err := os.WriteFile(outputPath, []byte(buf.String()), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote task index to %s\n", outputPath)
+	return nil
+}
+
+// getDocxTasks gets the Feishu tasks of the task blocks by block id. The
+// blocks of the tasks that can't be read are left to a note.
+func getDocxTasks(ctx context.Context, client core.DocSource, docToken string, blocks []*lark.DocxBlock) map[string]*core.DocxTask {
+	tasks := make(map[string]*core.DocxTask)
+	for _, blockID := range core.TaskBlockIDs(blocks) {
+		var task *core.DocxTask
+		err := dlPool.Do(func() (err error) {
+			task, err = client.GetDocxTask(ctx, docToken, blockID)
+			return err
+		})
+		if errors.Is(err, core.ErrPermissionDenied) {
+			fmt.Printf("Failed to get the tasks of %s, leaving a note in their place: %v\n", docToken, err)
+			break
+		} else if err != nil {
+			fmt.Printf("Failed to get the task of block %s: %v\n", blockID, err)
+			continue
+		}
+		tasks[blockID] = task
+	}
+	return tasks
+}
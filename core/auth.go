@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// UserToken is the user_access_token of the user logged in with OAuth on
+// the open platform of BaseURL
+type UserToken struct {
+	Name             string    `json:"name"`
+	BaseURL          string    `json:"base_url"`
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// tokenRefreshMargin refreshes the access token a bit before it expires, so
+// that it does not expire in the middle of a request.
+const tokenRefreshMargin = time.Minute
+
+func (t *UserToken) expired() bool {
+	return time.Now().Add(tokenRefreshMargin).After(t.ExpiresAt)
+}
+
+func GetTokenFilePath() (string, error) {
+	configPath, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	tokenFilePath := path.Join(configPath, "feishu2md", "token.json")
+	return tokenFilePath, nil
+}
+
+func ReadUserTokenFromFile(tokenPath string) (*UserToken, error) {
+	file, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	token := &UserToken{}
+	if err = json.Unmarshal(file, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (t *UserToken) WriteToFile(tokenPath string) error {
+	err := os.MkdirAll(filepath.Dir(tokenPath), 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the tokens grant access to all documents of the user
+	return os.WriteFile(tokenPath, file, 0o600)
+}
+
+// OAuthURL returns the url to authorize the app, which redirects to
+// redirectURI with the code and the state as query parameters.
+func (c *Client) OAuthURL(ctx context.Context, redirectURI, state string) string {
+	return c.larkClient.Auth.GenOAuthURL(ctx, &lark.GenOAuthURLReq{
+		RedirectURI: redirectURI,
+		State:       state,
+	})
+}
+
+// ExchangeCode gets the user token with the code of the OAuth redirect
+func (c *Client) ExchangeCode(ctx context.Context, code string) (*UserToken, error) {
+	resp, _, err := c.larkClient.Auth.GetAccessToken(ctx, &lark.GetAccessTokenReq{
+		GrantType: "authorization_code",
+		Code:      code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &UserToken{
+		Name:             resp.Name,
+		BaseURL:          c.openBaseURL,
+		AccessToken:      resp.AccessToken,
+		RefreshToken:     resp.RefreshToken,
+		ExpiresAt:        now.Add(time.Duration(resp.ExpiresIn) * time.Second),
+		RefreshExpiresAt: now.Add(time.Duration(resp.RefreshExpiresIn) * time.Second),
+	}, nil
+}
+
+// RefreshUserToken gets a new user token with the refresh token of t
+func (c *Client) RefreshUserToken(ctx context.Context, t *UserToken) (*UserToken, error) {
+	if time.Now().After(t.RefreshExpiresAt) {
+		return nil, errors.Errorf("the login of %s has expired, please run `feishu2md login` again", t.Name)
+	}
+	resp, _, err := c.larkClient.Auth.RefreshAccessToken(ctx, &lark.RefreshAccessTokenReq{
+		GrantType:    "refresh_token",
+		RefreshToken: t.RefreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &UserToken{
+		Name:             resp.Name,
+		BaseURL:          c.openBaseURL,
+		AccessToken:      resp.AccessToken,
+		RefreshToken:     resp.RefreshToken,
+		ExpiresAt:        now.Add(time.Duration(resp.ExpiresIn) * time.Second),
+		RefreshExpiresAt: now.Add(time.Duration(resp.RefreshExpiresIn) * time.Second),
+	}, nil
+}
+
+// methodOptions returns the options to call the APIs as the logged in user,
+// refreshing the user token when it is about to expire. It returns no
+// options for the app identity.
+func (c *Client) methodOptions(ctx context.Context) ([]lark.MethodOptionFunc, error) {
+	if c.userToken == nil {
+		return nil, nil
+	}
+	c.userTokenMu.Lock()
+	defer c.userTokenMu.Unlock()
+	if c.userToken.expired() {
+		token, err := c.RefreshUserToken(ctx, c.userToken)
+		if err != nil {
+			return nil, err
+		}
+		c.userToken = token
+		if c.onUserTokenRefresh != nil {
+			if err = c.onUserTokenRefresh(token); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return []lark.MethodOptionFunc{lark.WithUserAccessToken(c.userToken.AccessToken)}, nil
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chyroc/lark"
+)
+
+// DocxCache stores the blocks of the documents on disk by document id and
+// serves them as long as the revision of the document is unchanged.
+type DocxCache struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+// NewDocxCache creates a cache in dir, which drops the least recently used
+// documents to stay under maxSize bytes. A maxSize of 0 means no limit.
+func NewDocxCache(dir string, maxSize int64) *DocxCache {
+	return &DocxCache{dir: dir, maxSize: maxSize}
+}
+
+// DefaultCacheDir is the cache directory when the config leaves it empty
+func DefaultCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "feishu2md", "docx"), nil
+}
+
+func (c *DocxCache) path(documentID string) string {
+	return filepath.Join(c.dir, documentID+".json")
+}
+
+// Get returns the cached blocks of docx if its revision is cached
+func (c *DocxCache) Get(docx *lark.DocxDocument) ([]*lark.DocxBlock, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dump, err := ReadDocxDump(c.path(docx.DocumentID))
+	if err != nil || dump.Document.RevisionID != docx.RevisionID {
+		return nil, false
+	}
+	// keep the recently used documents when pruning
+	now := time.Now()
+	os.Chtimes(c.path(docx.DocumentID), now, now)
+	return dump.Blocks, true
+}
+
+// Put caches the blocks of the revision of docx
+func (c *DocxCache) Put(docx *lark.DocxDocument, blocks []*lark.DocxBlock) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(DocxDump{Document: docx, Blocks: blocks})
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(c.path(docx.DocumentID), data, 0o644); err != nil {
+		return err
+	}
+	return c.prune()
+}
+
+// prune removes the least recently used documents over the size limit
+func (c *DocxCache) prune() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var files []os.FileInfo
+	var size int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || info.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		files = append(files, info)
+		size += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, f := range files {
+		if size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil {
+			return err
+		}
+		size -= f.Size()
+	}
+	return nil
+}
+
+// CachedSource is a DocSource serving the unchanged documents from a
+// DocxCache, which only costs a request of the document revision.
+type CachedSource struct {
+	DocSource
+	Cache *DocxCache
+}
+
+func (s *CachedSource) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	docx, err := s.DocSource.GetDocxDocument(ctx, docToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blocks, ok := s.Cache.Get(docx); ok {
+		return docx, blocks, nil
+	}
+	blocks, err := s.DocSource.GetDocxBlocks(ctx, docx.DocumentID)
+	if err != nil {
+		return docx, nil, err
+	}
+	// the blocks are still good when the cache can't be written
+	if err = s.Cache.Put(docx, blocks); err != nil {
+		fmt.Printf("Failed to cache the blocks of %s: %v\n", docx.DocumentID, err)
+	}
+	return docx, blocks, nil
+}
+
+func (s *CachedSource) GetDocxBlocks(ctx context.Context, documentID string) ([]*lark.DocxBlock, error) {
+	_, blocks, err := s.GetDocxContent(ctx, documentID)
+	return blocks, err
+}
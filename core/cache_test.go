@@ -0,0 +1,111 @@
+package core_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingSource struct {
+	*core.MemorySource
+	blocks int
+}
+
+func (s *countingSource) GetDocxBlocks(ctx context.Context, documentID string) ([]*lark.DocxBlock, error) {
+	s.blocks++
+	return s.MemorySource.GetDocxBlocks(ctx, documentID)
+}
+
+func newCountingSource(t *testing.T) *countingSource {
+	source := core.NewMemorySource()
+	if err := source.LoadDir(filepath.Join(utils.RootDir(), "testdata", "fakefeishu")); err != nil {
+		t.Fatal(err)
+	}
+	return &countingSource{MemorySource: source}
+}
+
+func TestCachedSource(t *testing.T) {
+	ctx := context.Background()
+	source := newCountingSource(t)
+	cached := &core.CachedSource{
+		DocSource: source,
+		Cache:     core.NewDocxCache(t.TempDir(), 0),
+	}
+	docToken := "doxcnFakeReleaseNotes000001"
+
+	docx, blocks, err := cached.GetDocxContent(ctx, docToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, source.blocks)
+	_, want, _ := source.MemorySource.GetDocxContent(ctx, docToken)
+	assert.Equal(t, len(want), len(blocks))
+
+	// unchanged revision is served from the cache
+	_, cachedBlocks, err := cached.GetDocxContent(ctx, docToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, source.blocks)
+	assert.Equal(t, len(blocks), len(cachedBlocks))
+	assert.Equal(t, blocks[0].BlockID, cachedBlocks[0].BlockID)
+
+	// new revision is downloaded again
+	source.Documents[docToken].Document.RevisionID = docx.RevisionID + 1
+	_, _, err = cached.GetDocxContent(ctx, docToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, source.blocks)
+}
+
+func TestCachedSourceUnwritable(t *testing.T) {
+	ctx := context.Background()
+	source := newCountingSource(t)
+	// the cache directory is taken by a file
+	cacheDir := filepath.Join(t.TempDir(), "docx")
+	assert.NoError(t, os.WriteFile(cacheDir, nil, 0o644))
+	cached := &core.CachedSource{
+		DocSource: source,
+		Cache:     core.NewDocxCache(cacheDir, 0),
+	}
+
+	docx, blocks, err := cached.GetDocxContent(ctx, "doxcnFakeReleaseNotes000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "Release Notes", docx.Title)
+	assert.NotEmpty(t, blocks)
+}
+
+func TestDocxCachePrune(t *testing.T) {
+	ctx := context.Background()
+	source := newCountingSource(t)
+	dir := t.TempDir()
+
+	// measure a single document to fit only one into the cache
+	docToken := "doxcnFakeReleaseNotes000001"
+	docx, blocks, err := source.GetDocxContent(ctx, docToken)
+	assert.NoError(t, err)
+	assert.NoError(t, core.NewDocxCache(dir, 0).Put(docx, blocks))
+	info, err := os.Stat(filepath.Join(dir, docx.DocumentID+".json"))
+	assert.NoError(t, err)
+
+	cached := &core.CachedSource{
+		DocSource: source,
+		Cache:     core.NewDocxCache(dir, info.Size()),
+	}
+	_, _, err = cached.GetDocxContent(ctx, docToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, source.blocks)
+
+	_, _, err = cached.GetDocxContent(ctx, "doxcnFakeInstallGuide00001")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, source.blocks)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// the least recently used document was dropped
+	_, _, err = cached.GetDocxContent(ctx, docToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, source.blocks)
+}
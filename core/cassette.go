@@ -0,0 +1,235 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The environment variables to record the requests of the client into a
+// cassette file, or to replay them from it without network access.
+const (
+	CassetteEnv     = "FEISHU2MD_CASSETTE"
+	CassetteModeEnv = "FEISHU2MD_CASSETTE_MODE"
+
+	CassetteModeRecord = "record"
+	CassetteModeReplay = "replay"
+)
+
+// ErrNotRecorded is returned in replay mode for the requests missing in the
+// cassette, which are not retried.
+var ErrNotRecorded = errors.New("no interaction recorded")
+
+// redacted replaces the credentials and the access tokens in the cassette,
+// so that it can be shared in a bug report.
+const redacted = "REDACTED"
+
+// Interaction is a request of the client and its response
+type Interaction struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	Body           string      `json:"body,omitempty"`
+	Status         int         `json:"status"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	ResponseBody   []byte      `json:"response_body,omitempty"`
+}
+
+// Cassette is the http.RoundTripper to record or replay the interactions.
+// The cassette file holds an interaction in json per line, appended as soon
+// as it is recorded, so that it is complete even if the export fails
+// halfway.
+type Cassette struct {
+	Interactions []*Interaction
+
+	path string
+	mode string
+	next http.RoundTripper
+	mu   sync.Mutex
+	used []bool
+}
+
+// NewCassette records the requests sent with next into the cassette file
+// at path, or replays them from the file, according to mode.
+func NewCassette(path, mode string, next http.RoundTripper) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode, next: next}
+	switch mode {
+	case CassetteModeRecord:
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			return nil, err
+		}
+	case CassetteModeReplay:
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				it := &Interaction{}
+				if err := json.Unmarshal(line, it); err != nil {
+					return nil, errors.Wrapf(err, "invalid cassette %s", path)
+				}
+				c.Interactions = append(c.Interactions, it)
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		c.used = make([]bool, len(c.Interactions))
+	default:
+		return nil, errors.Errorf("unknown cassette mode %q, use %q or %q",
+			mode, CassetteModeRecord, CassetteModeReplay)
+	}
+	return c, nil
+}
+
+// isAuthPath tells whether the requests to path carry credentials or tokens
+func isAuthPath(path string) bool {
+	return strings.HasPrefix(path, "/open-apis/auth/") ||
+		strings.HasPrefix(path, "/open-apis/authen/")
+}
+
+// requestKey identifies a request regardless of the API domain
+func requestKey(req *http.Request) string {
+	return req.Method + " " + req.URL.RequestURI()
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body string
+	if req.Body != nil && !isAuthPath(req.URL.Path) {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	if c.mode == CassetteModeReplay {
+		return c.replay(req, body)
+	}
+	return c.record(req, body)
+}
+
+func (c *Cassette) replay(req *http.Request, body string) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// serve the interactions of a request in the order they were recorded,
+	// and the last one again for the extra requests
+	key := requestKey(req)
+	match := -1
+	for i, it := range c.Interactions {
+		if it.Method+" "+it.URL != key || it.Body != body {
+			continue
+		}
+		match = i
+		if !c.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, errors.Wrapf(ErrNotRecorded, "%s in %s", key, c.path)
+	}
+	c.used[match] = true
+	it := c.Interactions[match]
+	return &http.Response{
+		Status:        http.StatusText(it.Status),
+		StatusCode:    it.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        it.ResponseHeader.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(it.ResponseBody)),
+		ContentLength: int64(len(it.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+func (c *Cassette) record(req *http.Request, body string) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	it := &Interaction{
+		Method:         req.Method,
+		URL:            req.URL.RequestURI(),
+		Body:           body,
+		Status:         resp.StatusCode,
+		ResponseHeader: resp.Header.Clone(),
+		ResponseBody:   data,
+	}
+	if isAuthPath(req.URL.Path) {
+		it.ResponseBody = redactTokens(data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, it)
+	if err = c.append(it); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// redactTokens replaces the tokens in the json response of the auth APIs
+func redactTokens(data []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return []byte(redacted)
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok {
+			for k, val := range m {
+				if _, isStr := val.(string); isStr && strings.HasSuffix(k, "token") {
+					m[k] = redacted
+				} else {
+					walk(val)
+				}
+			}
+		}
+	}
+	walk(v)
+	redactedData, _ := json.Marshal(v)
+	return redactedData
+}
+
+// append writes the interaction at the end of the cassette file
+func (c *Cassette) append(it *Interaction) error {
+	line, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -5,32 +5,152 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/chyroc/lark"
 	"github.com/chyroc/lark_rate_limiter"
+	"golang.org/x/time/rate"
 )
 
+const (
+	defaultOpenBaseURL = "https://open.feishu.cn"
+	larkOpenBaseURL    = "https://open.larksuite.com"
+)
+
+// ResolveBaseURL returns the Open API base URL for a document url. The
+// apiDomain of the config wins when set, which is required for private
+// deployments; otherwise Lark hosts use open.larksuite.com and every other
+// host uses open.feishu.cn.
+func ResolveBaseURL(apiDomain, docURL string) string {
+	if apiDomain != "" {
+		if !strings.Contains(apiDomain, "://") {
+			apiDomain = "https://" + apiDomain
+		}
+		return strings.TrimRight(apiDomain, "/")
+	}
+	u, err := url.Parse(docURL)
+	if err != nil {
+		return defaultOpenBaseURL
+	}
+	host := u.Hostname()
+	if host == "larksuite.com" || strings.HasSuffix(host, ".larksuite.com") {
+		return larkOpenBaseURL
+	}
+	return defaultOpenBaseURL
+}
+
 type Client struct {
-	larkClient *lark.Lark
+	larkClient  *lark.Lark
+	openBaseURL string
+
+	userToken          *UserToken
+	onUserTokenRefresh func(*UserToken) error
+	userTokenMu        sync.Mutex
+}
+
+// ClientOption configures a Client created by NewClient
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	baseURL     string
+	userToken   *UserToken
+	onRefresh   func(*UserToken) error
+	retryPolicy RetryPolicy
+	rateLimit   float64
+	rateBurst   int
+	httpClient  *http.Client
+}
+
+// The default limits of the requests, which keep the exports under the
+// API quota of a tenant, and of the concurrent downloads
+const (
+	DefaultRateLimit = 4
+	DefaultRateBurst = 4
+	DefaultWorkers   = 10
+)
+
+// WithRateLimit limits the requests of the client to rps per second with
+// bursts of burst requests. All requests of the client share the limit.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(o *clientOptions) {
+		if rps > 0 {
+			o.rateLimit = rps
+		}
+		if burst > 0 {
+			o.rateBurst = burst
+		}
+	}
+}
+
+// WithBaseURL sends the API requests to baseURL instead of the Feishu Open
+// API, e.g. to a fake server in tests.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(o *clientOptions) {
+		o.baseURL = strings.TrimRight(baseURL, "/")
+	}
 }
 
-func NewClient(appID, appSecret string) *Client {
+// WithUserToken calls the APIs as the logged in user instead of the app, so
+// that the documents do not need to be shared with the app. The refreshed
+// tokens are passed to onRefresh, e.g. to save them.
+func WithUserToken(token *UserToken, onRefresh func(*UserToken) error) ClientOption {
+	return func(o *clientOptions) {
+		o.userToken = token
+		o.onRefresh = onRefresh
+	}
+}
+
+// WithHTTPClient sends the requests with cli, see NewHTTPClient
+func WithHTTPClient(cli *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		o.httpClient = cli
+	}
+}
+
+func NewClient(appID, appSecret string, opts ...ClientOption) *Client {
+	options := clientOptions{
+		baseURL:     defaultOpenBaseURL,
+		retryPolicy: defaultRetryPolicy,
+		rateLimit:   DefaultRateLimit,
+		rateBurst:   DefaultRateBurst,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	httpClient := options.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
 	return &Client{
 		larkClient: lark.New(
 			lark.WithAppCredential(appID, appSecret),
-			lark.WithTimeout(60*time.Second),
-			lark.WithApiMiddleware(lark_rate_limiter.Wait(4, 4)),
+			lark.WithOpenBaseURL(options.baseURL),
+			lark.WithNetHttpClient(httpClient),
+			lark.WithApiMiddleware(
+				retryMiddleware(options.retryPolicy),
+				lark_rate_limiter.Wait(rate.Limit(options.rateLimit), options.rateBurst),
+			),
 		),
+		openBaseURL:        options.baseURL,
+		userToken:          options.userToken,
+		onUserTokenRefresh: options.onRefresh,
 	}
 }
 
 func (c *Client) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return imgToken, err
+	}
 	resp, _, err := c.larkClient.Drive.DownloadDriveMedia(ctx, &lark.DownloadDriveMediaReq{
 		FileToken: imgToken,
-	})
+	}, opts...)
 	if err != nil {
 		return imgToken, err
 	}
@@ -53,9 +173,13 @@ func (c *Client) DownloadImage(ctx context.Context, imgToken, outDir string) (st
 }
 
 func (c *Client) DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return imgToken, nil, err
+	}
 	resp, _, err := c.larkClient.Drive.DownloadDriveMedia(ctx, &lark.DownloadDriveMediaReq{
 		FileToken: imgToken,
-	})
+	}, opts...)
 	if err != nil {
 		return imgToken, nil, err
 	}
@@ -67,40 +191,67 @@ func (c *Client) DownloadImageRaw(ctx context.Context, imgToken, imgDir string)
 }
 
 func (c *Client) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	docx, err := c.GetDocxDocument(ctx, docToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks, err := c.GetDocxBlocks(ctx, docx.DocumentID)
+	if err != nil {
+		return docx, nil, err
+	}
+	return docx, blocks, nil
+}
+
+func (c *Client) GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
 	resp, _, err := c.larkClient.Drive.GetDocxDocument(ctx, &lark.GetDocxDocumentReq{
 		DocumentID: docToken,
-	})
+	}, opts...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	docx := &lark.DocxDocument{
+	return &lark.DocxDocument{
 		DocumentID: resp.Document.DocumentID,
 		RevisionID: resp.Document.RevisionID,
 		Title:      resp.Document.Title,
+	}, nil
+}
+
+func (c *Client) GetDocxBlocks(ctx context.Context, documentID string) ([]*lark.DocxBlock, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
 	}
 	var blocks []*lark.DocxBlock
 	var pageToken *string
 	for {
-		resp2, _, err := c.larkClient.Drive.GetDocxBlockListOfDocument(ctx, &lark.GetDocxBlockListOfDocumentReq{
-			DocumentID: docx.DocumentID,
+		resp, _, err := c.larkClient.Drive.GetDocxBlockListOfDocument(ctx, &lark.GetDocxBlockListOfDocumentReq{
+			DocumentID: documentID,
 			PageToken:  pageToken,
-		})
+		}, opts...)
 		if err != nil {
-			return docx, nil, err
+			return nil, err
 		}
-		blocks = append(blocks, resp2.Items...)
-		pageToken = &resp2.PageToken
-		if !resp2.HasMore {
+		blocks = append(blocks, resp.Items...)
+		pageToken = &resp.PageToken
+		if !resp.HasMore {
 			break
 		}
 	}
-	return docx, blocks, nil
+	return blocks, nil
 }
 
 func (c *Client) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
 	resp, _, err := c.larkClient.Drive.GetWikiNode(ctx, &lark.GetWikiNodeReq{
 		Token: token,
-	})
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -108,11 +259,15 @@ func (c *Client) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWi
 }
 
 func (c *Client) GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
 	resp, _, err := c.larkClient.Drive.GetDriveFileList(ctx, &lark.GetDriveFileListReq{
 		PageSize:    nil,
 		PageToken:   pageToken,
 		FolderToken: folderToken,
-	})
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +277,7 @@ func (c *Client) GetDriveFolderFileList(ctx context.Context, pageToken *string,
 			PageSize:    nil,
 			PageToken:   &resp.NextPageToken,
 			FolderToken: folderToken,
-		})
+		}, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -131,10 +286,37 @@ func (c *Client) GetDriveFolderFileList(ctx context.Context, pageToken *string,
 	return files, nil
 }
 
+// maxMetaBatch is the most documents of a metas query
+const maxMetaBatch = 200
+
+// GetDriveFileMetas gets the owners and modified times of the documents.
+// The documents failed to query, e.g. without permission, are left out.
+func (c *Client) GetDriveFileMetas(ctx context.Context, docs []*lark.GetDriveFileMetaReqRequestDocs) ([]*lark.GetDriveFileMetaRespMeta, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var metas []*lark.GetDriveFileMetaRespMeta
+	for start := 0; start < len(docs); start += maxMetaBatch {
+		resp, _, err := c.larkClient.Drive.GetDriveFileMeta(ctx, &lark.GetDriveFileMetaReq{
+			RequestDocs: docs[start:min(start+maxMetaBatch, len(docs))],
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, resp.Metas...)
+	}
+	return metas, nil
+}
+
 func (c *Client) GetWikiName(ctx context.Context, spaceID string) (string, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return "", err
+	}
 	resp, _, err := c.larkClient.Drive.GetWikiSpace(ctx, &lark.GetWikiSpaceReq{
 		SpaceID: spaceID,
-	})
+	}, opts...)
 
 	if err != nil {
 		return "", err
@@ -144,12 +326,16 @@ func (c *Client) GetWikiName(ctx context.Context, spaceID string) (string, error
 }
 
 func (c *Client) GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*lark.GetWikiNodeListRespItem, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
 	resp, _, err := c.larkClient.Drive.GetWikiNodeList(ctx, &lark.GetWikiNodeListReq{
 		SpaceID:         spaceID,
 		PageSize:        nil,
 		PageToken:       nil,
 		ParentNodeToken: parentNodeToken,
-	})
+	}, opts...)
 
 	if err != nil {
 		return nil, err
@@ -160,12 +346,12 @@ func (c *Client) GetWikiNodeList(ctx context.Context, spaceID string, parentNode
 
 	for resp.HasMore && previousPageToken != resp.PageToken {
 		previousPageToken = resp.PageToken
-		resp, _, err := c.larkClient.Drive.GetWikiNodeList(ctx, &lark.GetWikiNodeListReq{
+		resp, _, err = c.larkClient.Drive.GetWikiNodeList(ctx, &lark.GetWikiNodeListReq{
 			SpaceID:         spaceID,
 			PageSize:        nil,
 			PageToken:       &resp.PageToken,
 			ParentNodeToken: parentNodeToken,
-		})
+		}, opts...)
 
 		if err != nil {
 			return nil, err
@@ -176,3 +362,82 @@ func (c *Client) GetWikiNodeList(ctx context.Context, spaceID string, parentNode
 
 	return nodes, nil
 }
+
+// DocxComment is a comment of the drive comment API. The lark SDK drops the
+// quote and is_whole fields, which are needed to anchor the comment.
+type DocxComment struct {
+	lark.GetDriveCommentListRespItem
+	IsWhole bool   `json:"is_whole,omitempty"`
+	Quote   string `json:"quote,omitempty"`
+}
+
+// GetUserName gets the name of a user by open id, which needs a permission
+// of the contact API
+func (c *Client) GetUserName(ctx context.Context, userID string) (string, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, _, err := c.larkClient.Contact.GetUser(ctx, &lark.GetUserReq{
+		UserID:     userID,
+		UserIDType: lark.IDTypePtr(lark.IDTypeOpenID),
+	}, opts...)
+	if err != nil {
+		return "", err
+	}
+	return resp.User.Name, nil
+}
+
+func (c *Client) GetDocxComments(ctx context.Context, docToken string) ([]*DocxComment, error) {
+	type listReq struct {
+		FileToken string        `path:"file_token" json:"-"`
+		FileType  lark.FileType `query:"file_type" json:"-"`
+		PageToken *string       `query:"page_token" json:"-"`
+	}
+	type listResp struct {
+		Code int64  `json:"code,omitempty"`
+		Msg  string `json:"msg,omitempty"`
+		Data *struct {
+			HasMore   bool           `json:"has_more,omitempty"`
+			PageToken string         `json:"page_token,omitempty"`
+			Items     []*DocxComment `json:"items,omitempty"`
+		} `json:"data,omitempty"`
+	}
+
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	methodOption := &lark.MethodOption{}
+	for _, opt := range opts {
+		opt(methodOption)
+	}
+
+	var comments []*DocxComment
+	var pageToken *string
+	for {
+		resp := new(listResp)
+		_, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+			Scope:                 "Drive",
+			API:                   "GetDriveCommentList",
+			Method:                "GET",
+			URL:                   c.openBaseURL + "/open-apis/drive/v1/files/:file_token/comments",
+			Body:                  &listReq{FileToken: docToken, FileType: lark.FileTypeDocx, PageToken: pageToken},
+			MethodOption:          methodOption,
+			NeedTenantAccessToken: true,
+			NeedUserAccessToken:   c.userToken != nil,
+		}, resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Data == nil {
+			break
+		}
+		comments = append(comments, resp.Data.Items...)
+		if !resp.Data.HasMore || resp.Data.PageToken == "" {
+			break
+		}
+		pageToken = &resp.Data.PageToken
+	}
+	return comments, nil
+}
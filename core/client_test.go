@@ -2,121 +2,122 @@ package core_test
 
 import (
 	"context"
-	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/core/fakefeishu"
+	"github.com/Wsine/feishu2md/utils"
 )
 
-func getIdAndSecretFromEnv(t *testing.T) (string, string) {
-	appID := ""
-	appSecret := ""
-
-	configPath, err := core.GetConfigFilePath()
+// newTestClient serves the fakefeishu fixtures to a client, so that the
+// client is tested without credentials or network access
+func newTestClient(t *testing.T) *core.Client {
+	server, err := fakefeishu.NewServerFromDir(filepath.Join(utils.RootDir(), "testdata", "fakefeishu"))
 	if err != nil {
-		t.Error(err)
-	}
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		appID = os.Getenv("FEISHU_APP_ID")
-		appSecret = os.Getenv("FEISHU_APP_SECRET")
-	} else {
-		config, err := core.ReadConfigFromFile(configPath)
-		if err != nil {
-			t.Error(err)
-		}
-		appID = config.Feishu.AppId
-		appSecret = config.Feishu.AppSecret
+		t.Fatal(err)
 	}
-
-	return appID, appSecret
+	t.Cleanup(server.Close)
+	return core.NewClient("cli_fake", "secret", core.WithBaseURL(server.URL))
 }
 
 func TestNewClient(t *testing.T) {
-	appID, appSecret := getIdAndSecretFromEnv(t)
-	c := core.NewClient(appID, appSecret)
+	c := core.NewClient("cli_fake", "secret")
 	if c == nil {
 		t.Errorf("Error creating DocClient")
 	}
 }
 
 func TestDownloadImage(t *testing.T) {
-	appID, appSecret := getIdAndSecretFromEnv(t)
-	c := core.NewClient(appID, appSecret)
-	imgToken := "boxcnA1QKPanfMhLxzF1eMhoArM"
+	c := newTestClient(t)
+	imgToken := "boxcnFakeDiagram0000000001"
+	outDir := filepath.Join(t.TempDir(), "static")
 	filename, err := c.DownloadImage(
 		context.Background(),
 		imgToken,
-		"static",
+		outDir,
 	)
 	if err != nil {
 		t.Error(err)
 	}
-	if filename != "static/"+imgToken+".png" {
-		fmt.Println(filename)
-		t.Errorf("Error: not expected file extension")
+	if filename != filepath.Join(outDir, imgToken+".png") {
+		t.Errorf("Error: not expected file extension: %s", filename)
 	}
-	if err := os.RemoveAll("static"); err != nil {
-		t.Errorf("Error: failed to clean up the folder")
+	if _, err := os.Stat(filename); err != nil {
+		t.Errorf("Error: image not saved: %v", err)
 	}
 }
 
 func TestGetDocxContent(t *testing.T) {
-	appID, appSecret := getIdAndSecretFromEnv(t)
-	c := core.NewClient(appID, appSecret)
+	c := newTestClient(t)
 	docx, blocks, err := c.GetDocxContent(
 		context.Background(),
-		"doxcnXhd93zqoLnmVPGIPTy7AFe",
+		"doxcnFakeInstallGuide00001",
 	)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	fmt.Println(docx.Title)
-	if docx.Title == "" {
-		t.Errorf("Error: parsed title is empty")
+	if docx.Title != "Install Guide" {
+		t.Errorf("Error: parsed title is %q", docx.Title)
 	}
-	fmt.Printf("number of blocks: %d\n", len(blocks))
 	if len(blocks) == 0 {
 		t.Errorf("Error: parsed blocks are empty")
 	}
 }
 
 func TestGetWikiNodeInfo(t *testing.T) {
-	appID, appSecret := getIdAndSecretFromEnv(t)
-	c := core.NewClient(appID, appSecret)
-	const token = "wikcnLgRX9AMtvaB5x1cl57Yuah"
+	c := newTestClient(t)
+	const token = "wikcnFakeInstallGuide"
 	node, err := c.GetWikiNodeInfo(context.Background(), token)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	if node.ObjType != "docx" {
+	if node.ObjType != "docx" || node.ObjToken != "doxcnFakeInstallGuide00001" {
 		t.Errorf("Error: node type incorrect")
 	}
 }
 
 func TestGetDriveFolderFileList(t *testing.T) {
-	appID, appSecret := getIdAndSecretFromEnv(t)
-	c := core.NewClient(appID, appSecret)
-	folderToken := "G15mfSfIHlyquudfhq5cg9kdnjg"
+	c := newTestClient(t)
+	folderToken := "fldcnFakeRoot"
 	files, err := c.GetDriveFolderFileList(
 		context.Background(), nil, &folderToken)
 	if err != nil {
 		t.Error(err)
 	}
-	if len(files) == 0 {
-		t.Errorf("Error: no files found")
+	if len(files) != 3 {
+		t.Errorf("Error: found %d files", len(files))
 	}
 }
 
 func TestGetWikiNodeList(t *testing.T) {
-	appID, appSecret := getIdAndSecretFromEnv(t)
-	c := core.NewClient(appID, appSecret)
-	wikiToken := "7376995595006787612"
+	c := newTestClient(t)
+	wikiToken := "7100000000000000001"
 	nodes, err := c.GetWikiNodeList(context.Background(), wikiToken, nil)
 	if err != nil {
 		t.Error(err)
 	}
-	if len(nodes) == 0 {
-		t.Errorf("Error: no nodes found")
+	if len(nodes) != 1 || nodes[0].Title != "Release Notes" {
+		t.Errorf("Error: root nodes incorrect")
+	}
+}
+
+func TestResolveBaseURL(t *testing.T) {
+	tests := []struct {
+		apiDomain string
+		docURL    string
+		want      string
+	}{
+		{"", "https://sample.feishu.cn/docx/doxcnXhd93zqoLnmVPGIPTy7AFe", "https://open.feishu.cn"},
+		{"", "https://sample.larksuite.com/wiki/settings/7000", "https://open.larksuite.com"},
+		{"", "https://xiaomi.f.mioffice.cn/docx/doxcnXhd93zqoLnmVPGIPTy7AFe", "https://open.feishu.cn"},
+		{"open.f.mioffice.cn", "https://xiaomi.f.mioffice.cn/docx/doxcnXhd93zqoLnmVPGIPTy7AFe", "https://open.f.mioffice.cn"},
+		{"http://127.0.0.1:8080/", "https://sample.feishu.cn/docx/doxcnXhd93zqoLnmVPGIPTy7AFe", "http://127.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		if got := core.ResolveBaseURL(tt.apiDomain, tt.docURL); got != tt.want {
+			t.Errorf("ResolveBaseURL(%q, %q) = %q, want %q", tt.apiDomain, tt.docURL, got, tt.want)
+		}
 	}
 }
@@ -2,26 +2,53 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+
+	"github.com/Wsine/feishu2md/utils"
 )
 
 type Config struct {
 	Feishu FeishuConfig `json:"feishu"`
 	Output OutputConfig `json:"output"`
+	HTTP   HTTPConfig   `json:"http"`
+	Cache  CacheConfig  `json:"cache"`
 }
 
 type FeishuConfig struct {
-	AppId     string `json:"app_id"`
-	AppSecret string `json:"app_secret"`
+	AppId     string  `json:"app_id"`
+	AppSecret string  `json:"app_secret"`
+	ApiDomain string  `json:"api_domain"`
+	RateLimit float64 `json:"rate_limit"`
+	RateBurst int     `json:"rate_burst"`
+	Workers   int     `json:"workers"`
+}
+
+type HTTPConfig struct {
+	Proxy              string `json:"proxy"`
+	CABundle           string `json:"ca_bundle"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	Timeout            int    `json:"timeout"`
+}
+
+type CacheConfig struct {
+	Dir       string `json:"dir"`
+	MaxSizeMB int    `json:"max_size_mb"`
 }
 
 type OutputConfig struct {
-	ImageDir        string `json:"image_dir"`
-	TitleAsFilename bool   `json:"title_as_filename"`
-	UseHTMLTags     bool   `json:"use_html_tags"`
-	SkipImgDownload bool   `json:"skip_img_download"`
+	ImageDir        string            `json:"image_dir"`
+	TitleAsFilename bool              `json:"title_as_filename"`
+	UseHTMLTags     bool              `json:"use_html_tags"`
+	SkipImgDownload bool              `json:"skip_img_download"`
+	CodeLanguageMap map[string]string `json:"code_language_map"`
+	CommentStyle    string            `json:"comment_style"`
+	MathDialect     string            `json:"math_dialect"`
+	TOC             bool              `json:"toc"`
+	SlugStyle       string            `json:"slug_style"`
+	PathTemplate    string            `json:"path_template"`
 }
 
 func NewConfig(appId, appSecret string) *Config {
@@ -29,12 +56,31 @@ func NewConfig(appId, appSecret string) *Config {
 		Feishu: FeishuConfig{
 			AppId:     appId,
 			AppSecret: appSecret,
+			RateLimit: DefaultRateLimit,
+			RateBurst: DefaultRateBurst,
+			Workers:   DefaultWorkers,
 		},
 		Output: OutputConfig{
 			ImageDir:        "static",
 			TitleAsFilename: false,
 			UseHTMLTags:     false,
 			SkipImgDownload: false,
+			CodeLanguageMap: map[string]string{},
+			CommentStyle:    "",
+			MathDialect:     MathDialectDollar,
+			TOC:             false,
+			SlugStyle:       utils.SlugStyleGitHub,
+			PathTemplate:    "",
+		},
+		HTTP: HTTPConfig{
+			Proxy:              "",
+			CABundle:           "",
+			InsecureSkipVerify: false,
+			Timeout:            60,
+		},
+		Cache: CacheConfig{
+			Dir:       "",
+			MaxSizeMB: 512,
 		},
 	}
 }
@@ -58,9 +104,35 @@ func ReadConfigFromFile(configPath string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := config.Output.Validate(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// Validate checks the values of the output options
+func (conf *OutputConfig) Validate() error {
+	switch conf.CommentStyle {
+	case "", CommentStyleFootnote, CommentStyleAppendix:
+	default:
+		return fmt.Errorf("invalid comment_style %q, expected %s or %s",
+			conf.CommentStyle, CommentStyleFootnote, CommentStyleAppendix)
+	}
+	switch conf.MathDialect {
+	case "", MathDialectDollar, MathDialectLaTeX, MathDialectGitLab, MathDialectMathML:
+	default:
+		return fmt.Errorf("invalid math_dialect %q, expected %s, %s, %s or %s",
+			conf.MathDialect, MathDialectDollar, MathDialectLaTeX, MathDialectGitLab, MathDialectMathML)
+	}
+	switch conf.SlugStyle {
+	case "", utils.SlugStyleGitHub, utils.SlugStyleGitLab, utils.SlugStyleHugo, utils.SlugStyleDocusaurus:
+	default:
+		return fmt.Errorf("invalid slug_style %q, expected %s, %s, %s or %s", conf.SlugStyle,
+			utils.SlugStyleGitHub, utils.SlugStyleGitLab, utils.SlugStyleHugo, utils.SlugStyleDocusaurus)
+	}
+	return nil
+}
+
 func (conf *Config) WriteConfig2File(configPath string) error {
 	err := os.MkdirAll(filepath.Dir(configPath), 0o755)
 	if err != nil {
@@ -0,0 +1,36 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConfigFromFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+
+	config := core.NewConfig("cli_fake", "secret")
+	config.Output.CommentStyle = core.CommentStyleAppendix
+	assert.NoError(t, config.WriteConfig2File(configPath))
+	config, err := core.ReadConfigFromFile(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, core.CommentStyleAppendix, config.Output.CommentStyle)
+
+	err = os.WriteFile(configPath, []byte(`{"output": {"comment_style": "inline"}}`), 0o644)
+	assert.NoError(t, err)
+	_, err = core.ReadConfigFromFile(configPath)
+	assert.ErrorContains(t, err, "comment_style")
+
+	err = os.WriteFile(configPath, []byte(`{"output": {"math_dialect": "mathjax"}}`), 0o644)
+	assert.NoError(t, err)
+	_, err = core.ReadConfigFromFile(configPath)
+	assert.ErrorContains(t, err, "math_dialect")
+
+	err = os.WriteFile(configPath, []byte(`{"output": {"slug_style": "githb"}}`), 0o644)
+	assert.NoError(t, err)
+	_, err = core.ReadConfigFromFile(configPath)
+	assert.ErrorContains(t, err, "slug_style")
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chyroc/lark"
+)
+
+// The kinds of the errors returned by the Open API, to be checked with
+// errors.Is on the errors returned by Client.
+var (
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrNotFound           = errors.New("not found")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// APIError is a failed request of the Open API
+type APIError struct {
+	Kind       error // one of the Err* kinds, or nil when unclassified
+	API        string
+	StatusCode int
+	Code       int64
+	Msg        string
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	if e.Kind == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *APIError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// error codes of https://open.feishu.cn/document/server-docs/api-call-guide/generic-error-code
+// and of the docx, wiki and drive APIs
+var (
+	rateLimitedCodes = map[int64]bool{
+		99991400: true, // request trigger frequency limit
+	}
+	invalidCredentialsCodes = map[int64]bool{
+		10003:    true, // invalid app_id or app_secret
+		10014:    true, // app secret invalid
+		99991661: true, // missing access token
+		99991663: true, // invalid tenant access token
+		99991664: true, // invalid app access token
+		99991665: true, // invalid tenant code
+		99991668: true, // invalid user access token
+		99991677: true, // user access token expired
+	}
+	permissionDeniedCodes = map[int64]bool{
+		99991672: true, // app scope not enabled
+		99991679: true, // user scope not granted
+		1770032:  true, // docx forbidden
+		131006:   true, // wiki permission denied
+		1061004:  true, // drive forbidden
+		1063002:  true, // drive permission denied
+		41050:    true, // contact no user authority
+	}
+	notFoundCodes = map[int64]bool{
+		1770002: true, // docx not found
+		1770003: true, // docx deleted
+		131005:  true, // wiki node not found
+		1061003: true, // drive file not found
+		1061007: true, // drive file deleted
+	}
+)
+
+func newAPIError(req *lark.RawRequestReq, resp *lark.Response, err error) *APIError {
+	e := &APIError{API: req.Scope + "#" + req.API, Err: err}
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+	}
+	var larkErr *lark.Error
+	if errors.As(err, &larkErr) {
+		e.Code = larkErr.Code
+		e.Msg = larkErr.Msg
+	}
+
+	switch {
+	case rateLimitedCodes[e.Code] || e.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case invalidCredentialsCodes[e.Code] || e.StatusCode == http.StatusUnauthorized:
+		e.Kind = ErrInvalidCredentials
+	case permissionDeniedCodes[e.Code] || e.StatusCode == http.StatusForbidden:
+		e.Kind = ErrPermissionDenied
+	case notFoundCodes[e.Code] || e.StatusCode == http.StatusNotFound:
+		e.Kind = ErrNotFound
+	}
+	return e
+}
+
+// ErrorHint returns what the user can do about err, or "" when unknown
+func ErrorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrPermissionDenied):
+		return "Share the document with your app (or add the app to the wiki space), " +
+			"or run `feishu2md login` to download with your own identity. " +
+			"Also check the scopes enabled for the app."
+	case errors.Is(err, ErrNotFound):
+		return "Check the url, the document may have been moved or deleted."
+	case errors.Is(err, ErrRateLimited):
+		return "The API quota of the tenant is exhausted, retry later or lower the request rate."
+	case errors.Is(err, ErrInvalidCredentials):
+		return "Check app_id and app_secret with `feishu2md config`, " +
+			"or run `feishu2md login` again if you logged in."
+	}
+	return ""
+}
@@ -0,0 +1,659 @@
+// Package fakefeishu provides a fake Feishu Open API server for tests.
+package fakefeishu
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+)
+
+const (
+	// TenantAccessToken is the token granted to any app credential
+	TenantAccessToken = "t-fakefeishu"
+	// AppAccessToken is the app token granted to any app credential
+	AppAccessToken = "a-fakefeishu"
+	// AuthorizationCode is the OAuth code accepted for the user login
+	AuthorizationCode = "fakefeishu-code"
+	// UserName is the name of the user logged in with AuthorizationCode
+	UserName = "Fake User"
+)
+
+// Server is a fake Feishu Open API backed by a core.MemorySource. It serves
+// the endpoints used by core.Client, so that the export can be tested end
+// to end with core.WithBaseURL(server.URL) and without network access.
+type Server struct {
+	*httptest.Server
+	Source *core.MemorySource
+	// PageSize is the number of items per page of the list APIs, all the
+	// items are returned in one page when it is 0.
+	PageSize int
+
+	mu            sync.Mutex
+	failures      map[string]failure
+	requests      []string
+	userTokens    map[string]bool
+	refreshTokens map[string]bool
+}
+
+type failure struct {
+	status int
+	code   int64
+	msg    string
+	times  int // 0 for every request
+}
+
+// NewServer starts a server for the given source. Call Close when done.
+func NewServer(source *core.MemorySource) *Server {
+	s := &Server{
+		Source:        source,
+		failures:      make(map[string]failure),
+		userTokens:    make(map[string]bool),
+		refreshTokens: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewServerFromDir starts a server for the fixture directory, see
+// core.MemorySource.LoadDir for its layout.
+func NewServerFromDir(dir string) (*Server, error) {
+	source := core.NewMemorySource()
+	if err := source.LoadDir(dir); err != nil {
+		return nil, err
+	}
+	return NewServer(source), nil
+}
+
+// Fail makes every request to path respond with the status and the error
+// code until it is reset with a zero status.
+func (s *Server) Fail(path string, status int, code int64, msg string) {
+	s.FailTimes(path, 0, status, code, msg)
+}
+
+// FailTimes makes the next n requests to path respond with the status and
+// the error code, or every request when n is 0.
+func (s *Server) FailTimes(path string, n int, status int, code int64, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.failures, path)
+		return
+	}
+	s.failures[path] = failure{status: status, code: code, msg: msg, times: n}
+}
+
+// Requests returns the "METHOD /path?query" of the requests served so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	f, failed := s.failures[r.URL.Path]
+	if failed && f.times > 0 {
+		if f.times--; f.times == 0 {
+			delete(s.failures, r.URL.Path)
+		} else {
+			s.failures[r.URL.Path] = f
+		}
+	}
+	s.mu.Unlock()
+	if failed {
+		writeError(w, f.status, f.code, f.msg)
+		return
+	}
+
+	path := r.URL.Path
+	if path == "/open-apis/auth/v3/tenant_access_token/internal" {
+		writeJSON(w, map[string]interface{}{
+			"code":                0,
+			"msg":                 "ok",
+			"tenant_access_token": TenantAccessToken,
+			"expire":              7200,
+		})
+		return
+	}
+	if path == "/open-apis/auth/v3/app_access_token/internal" {
+		writeJSON(w, map[string]interface{}{
+			"code":             0,
+			"msg":              "ok",
+			"app_access_token": AppAccessToken,
+			"expire":           7200,
+		})
+		return
+	}
+	if path == "/open-apis/authen/v1/access_token" || path == "/open-apis/authen/v1/refresh_access_token" {
+		s.grantUserToken(w, r)
+		return
+	}
+	if !s.authorized(r.Header.Get("Authorization")) {
+		writeError(w, http.StatusBadRequest, 99991663, "Invalid access token for authorization")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/open-apis/docx/v1/documents/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/open-apis/docx/v1/documents/"), "/")
+		if len(parts) == 1 {
+			s.getDocument(w, r, parts[0])
+			return
+		}
+		if len(parts) == 2 && parts[1] == "blocks" {
+			s.listBlocks(w, r, parts[0])
+			return
+		}
+		if len(parts) == 3 && parts[1] == "blocks" {
+			s.getTaskBlock(w, r, parts[0], parts[2])
+			return
+		}
+	case path == "/open-apis/wiki/v2/spaces/get_node":
+		s.getWikiNode(w, r)
+		return
+	case strings.HasPrefix(path, "/open-apis/wiki/v2/spaces/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/open-apis/wiki/v2/spaces/"), "/")
+		if len(parts) == 1 {
+			s.getWikiSpace(w, r, parts[0])
+			return
+		}
+		if len(parts) == 2 && parts[1] == "nodes" {
+			s.listWikiNodes(w, r, parts[0])
+			return
+		}
+	case path == "/open-apis/drive/v1/files":
+		s.listFiles(w, r)
+		return
+	case path == "/open-apis/drive/v1/metas/batch_query":
+		s.queryMetas(w, r)
+		return
+	case strings.HasPrefix(path, "/open-apis/drive/v1/files/") && strings.HasSuffix(path, "/comments"):
+		token := strings.TrimSuffix(strings.TrimPrefix(path, "/open-apis/drive/v1/files/"), "/comments")
+		s.listComments(w, r, token)
+		return
+	case strings.HasPrefix(path, "/open-apis/task/v2/tasks/"):
+		s.getTask(w, r, strings.TrimPrefix(path, "/open-apis/task/v2/tasks/"))
+		return
+	case strings.HasPrefix(path, "/open-apis/contact/v3/users/"):
+		s.getUser(w, r, strings.TrimPrefix(path, "/open-apis/contact/v3/users/"))
+		return
+	case strings.HasPrefix(path, "/open-apis/drive/v1/files/") && strings.HasSuffix(path, "/download"):
+		token := strings.TrimSuffix(strings.TrimPrefix(path, "/open-apis/drive/v1/files/"), "/download")
+		s.downloadMedia(w, r, token)
+		return
+	case strings.HasPrefix(path, "/open-apis/drive/v1/medias/") && strings.HasSuffix(path, "/download"):
+		token := strings.TrimSuffix(strings.TrimPrefix(path, "/open-apis/drive/v1/medias/"), "/download")
+		s.downloadMedia(w, r, token)
+		return
+	case path == "/open-apis/drive/v1/export_tasks":
+		s.createExportTask(w, r)
+		return
+	case strings.HasPrefix(path, "/open-apis/drive/v1/export_tasks/file/") && strings.HasSuffix(path, "/download"):
+		token := strings.TrimSuffix(strings.TrimPrefix(path, "/open-apis/drive/v1/export_tasks/file/"), "/download")
+		s.downloadExport(w, r, token)
+		return
+	case strings.HasPrefix(path, "/open-apis/drive/v1/export_tasks/"):
+		s.getExportTask(w, r, strings.TrimPrefix(path, "/open-apis/drive/v1/export_tasks/"))
+		return
+	case strings.HasPrefix(path, "/open-apis/sheets/v3/spreadsheets/") && strings.HasSuffix(path, "/sheets/query"):
+		token := strings.TrimSuffix(strings.TrimPrefix(path, "/open-apis/sheets/v3/spreadsheets/"), "/sheets/query")
+		s.querySheets(w, r, token)
+		return
+	case strings.HasPrefix(path, "/open-apis/sheets/v2/spreadsheets/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/open-apis/sheets/v2/spreadsheets/"), "/")
+		if len(parts) == 3 && parts[1] == "values" {
+			s.getSheetValues(w, r, parts[0], parts[2])
+			return
+		}
+	case strings.HasPrefix(path, "/open-apis/bitable/v1/apps/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/open-apis/bitable/v1/apps/"), "/")
+		if len(parts) == 2 && parts[1] == "tables" {
+			s.listBitableTables(w, r, parts[0])
+			return
+		}
+		if len(parts) == 4 && parts[1] == "tables" && (parts[3] == "fields" || parts[3] == "records") {
+			s.listBitableRecords(w, r, parts[0], parts[2], parts[3])
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, 404, "404 page not found")
+}
+
+// IssueUserToken returns a new user access token accepted by the server
+func (s *Server) IssueUserToken() (accessToken, refreshToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.userTokens) + 1
+	accessToken = fmt.Sprintf("u-fakefeishu-%d", n)
+	refreshToken = fmt.Sprintf("ur-fakefeishu-%d", n)
+	s.userTokens[accessToken] = true
+	s.refreshTokens[refreshToken] = true
+	return accessToken, refreshToken
+}
+
+func (s *Server) authorized(authorization string) bool {
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if token == TenantAccessToken {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userTokens[token]
+}
+
+func (s *Server) grantUserToken(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+AppAccessToken {
+		writeError(w, http.StatusBadRequest, 99991663, "Invalid access token for authorization")
+		return
+	}
+	var req struct {
+		GrantType    string `json:"grant_type"`
+		Code         string `json:"code"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, 20001, "invalid request")
+		return
+	}
+	switch req.GrantType {
+	case "authorization_code":
+		if req.Code != AuthorizationCode {
+			writeError(w, http.StatusBadRequest, 20003, "invalid code")
+			return
+		}
+	case "refresh_token":
+		s.mu.Lock()
+		valid := s.refreshTokens[req.RefreshToken]
+		delete(s.refreshTokens, req.RefreshToken)
+		s.mu.Unlock()
+		if !valid {
+			writeError(w, http.StatusBadRequest, 20026, "invalid refresh token")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, 20001, "invalid grant type")
+		return
+	}
+	accessToken, refreshToken := s.IssueUserToken()
+	writeData(w, &lark.GetAccessTokenResp{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        7200,
+		Name:             UserName,
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: 2592000,
+	})
+}
+
+func (s *Server) getDocument(w http.ResponseWriter, r *http.Request, docToken string) {
+	docx, _, err := s.Source.GetDocxContent(r.Context(), docToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	writeData(w, &lark.GetDocxDocumentResp{
+		Document: &lark.GetDocxDocumentRespDocument{
+			DocumentID: docx.DocumentID,
+			RevisionID: docx.RevisionID,
+			Title:      docx.Title,
+		},
+	})
+}
+
+func (s *Server) listBlocks(w http.ResponseWriter, r *http.Request, docToken string) {
+	_, blocks, err := s.Source.GetDocxContent(r.Context(), docToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	items, next, hasMore := page(blocks, r, s.PageSize)
+	writeData(w, &lark.GetDocxBlockListOfDocumentResp{
+		Items: items, PageToken: next, HasMore: hasMore,
+	})
+}
+
+// getTaskBlock serves a task block with its task id, the other blocks are
+// only listed
+func (s *Server) getTaskBlock(w http.ResponseWriter, r *http.Request, docToken, blockID string) {
+	task, err := s.Source.GetDocxTask(r.Context(), docToken, blockID)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	writeData(w, map[string]interface{}{
+		"block": map[string]interface{}{
+			"block_id":   blockID,
+			"block_type": core.DocxBlockTypeTask,
+			"task":       map[string]string{"task_id": task.GUID},
+		},
+	})
+}
+
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request, guid string) {
+	tasks := []map[string]*core.DocxTask{s.Source.Tasks}
+	for _, dump := range s.Source.Documents {
+		tasks = append(tasks, dump.Tasks)
+	}
+	for _, byBlock := range tasks {
+		for _, task := range byBlock {
+			if task.GUID == guid {
+				writeData(w, map[string]interface{}{"task": task})
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, 1470404, "task not found")
+}
+
+func (s *Server) getWikiNode(w http.ResponseWriter, r *http.Request) {
+	node, err := s.Source.GetWikiNodeInfo(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	writeData(w, &lark.GetWikiNodeResp{Node: node})
+}
+
+func (s *Server) getWikiSpace(w http.ResponseWriter, r *http.Request, spaceID string) {
+	name, err := s.Source.GetWikiName(r.Context(), spaceID)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	writeData(w, &lark.GetWikiSpaceResp{
+		Space: &lark.GetWikiSpaceRespSpace{SpaceID: spaceID, Name: name},
+	})
+}
+
+func (s *Server) listWikiNodes(w http.ResponseWriter, r *http.Request, spaceID string) {
+	if _, err := s.Source.GetWikiName(r.Context(), spaceID); err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	var parentNodeToken *string
+	if token := r.URL.Query().Get("parent_node_token"); token != "" {
+		parentNodeToken = &token
+	}
+	nodes, err := s.Source.GetWikiNodeList(r.Context(), spaceID, parentNodeToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	items, next, hasMore := page(nodes, r, s.PageSize)
+	writeData(w, &lark.GetWikiNodeListResp{
+		Items: items, PageToken: next, HasMore: hasMore,
+	})
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	folderToken := r.URL.Query().Get("folder_token")
+	files, err := s.Source.GetDriveFolderFileList(r.Context(), nil, &folderToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	items, next, hasMore := page(files, r, s.PageSize)
+	writeData(w, &lark.GetDriveFileListResp{
+		Files: items, NextPageToken: next, HasMore: hasMore,
+	})
+}
+
+func (s *Server) queryMetas(w http.ResponseWriter, r *http.Request) {
+	req := &lark.GetDriveFileMetaReq{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	metas, _ := s.Source.GetDriveFileMetas(r.Context(), req.RequestDocs)
+	resp := &lark.GetDriveFileMetaResp{Metas: metas}
+	for _, doc := range req.RequestDocs {
+		if _, ok := s.Source.Metas[doc.DocToken]; !ok {
+			resp.FailedList = append(resp.FailedList,
+				&lark.GetDriveFileMetaRespFailed{Token: doc.DocToken, Code: 970005})
+		}
+	}
+	writeData(w, resp)
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request, docToken string) {
+	comments, err := s.Source.GetDocxComments(r.Context(), docToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	items, next, hasMore := page(comments, r, s.PageSize)
+	writeData(w, map[string]interface{}{
+		"items": items, "page_token": next, "has_more": hasMore,
+	})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request, userID string) {
+	name, err := s.Source.GetUserName(r.Context(), userID)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	writeData(w, &lark.GetUserResp{User: &lark.GetUserRespUser{OpenID: userID, Name: name}})
+}
+
+func (s *Server) downloadMedia(w http.ResponseWriter, r *http.Request, fileToken string) {
+	file, ok := s.Source.Files[fileToken]
+	if !ok {
+		writeError(w, http.StatusNotFound, 1061004, "file not found")
+		return
+	}
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(file.Data)
+}
+
+func (s *Server) querySheets(w http.ResponseWriter, r *http.Request, spreadsheetToken string) {
+	sheets, err := s.Source.GetSheets(r.Context(), spreadsheetToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	resp := &lark.GetSheetListResp{}
+	for i, sheet := range sheets {
+		var columns int
+		for _, row := range sheet.Values {
+			if len(row) > columns {
+				columns = len(row)
+			}
+		}
+		resp.Sheets = append(resp.Sheets, &lark.GetSheetListRespSheet{
+			SheetID:      sheet.SheetID,
+			Title:        sheet.Title,
+			Index:        int64(i),
+			ResourceType: "sheet",
+			GridProperties: &lark.GetSheetListRespSheetGridProperties{
+				RowCount:    int64(len(sheet.Values)),
+				ColumnCount: int64(columns),
+			},
+		})
+	}
+	writeData(w, resp)
+}
+
+// getSheetValues serves the whole worksheet whatever the cell range
+func (s *Server) getSheetValues(w http.ResponseWriter, r *http.Request, spreadsheetToken, valueRange string) {
+	sheets, err := s.Source.GetSheets(r.Context(), spreadsheetToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	sheetID, cells, _ := strings.Cut(valueRange, "!")
+	for _, sheet := range sheets {
+		if sheet.SheetID == sheetID {
+			// serve the rows of the range like A2:C3
+			values := sheet.Values
+			first, last, _ := strings.Cut(cells, ":")
+			start, err := strconv.Atoi(strings.TrimLeft(first, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, 90202, "invalid range")
+				return
+			}
+			end, err := strconv.Atoi(strings.TrimLeft(last, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, 90202, "invalid range")
+				return
+			}
+			if end > len(values) {
+				end = len(values)
+			}
+			if start > end {
+				values = nil
+			} else {
+				values = values[start-1 : end]
+			}
+			writeData(w, map[string]interface{}{
+				"spreadsheetToken": spreadsheetToken,
+				"valueRange":       map[string]interface{}{"range": valueRange, "values": values},
+			})
+			return
+		}
+	}
+	writeNotFound(w, fmt.Errorf("sheet %s not found", sheetID))
+}
+
+func (s *Server) listBitableTables(w http.ResponseWriter, r *http.Request, appToken string) {
+	tables, err := s.Source.GetBitableTables(r.Context(), appToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	var items []*lark.GetBitableTableListRespItem
+	for _, table := range tables {
+		items = append(items, &lark.GetBitableTableListRespItem{TableID: table.TableID, Name: table.Name})
+	}
+	items, next, hasMore := page(items, r, s.PageSize)
+	writeData(w, &lark.GetBitableTableListResp{Items: items, PageToken: next, HasMore: hasMore})
+}
+
+// listBitableRecords serves the fields or the records of a table, where a
+// field value is its text
+func (s *Server) listBitableRecords(w http.ResponseWriter, r *http.Request, appToken, tableID, list string) {
+	tables, err := s.Source.GetBitableTables(r.Context(), appToken)
+	if err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	for _, table := range tables {
+		if table.TableID != tableID {
+			continue
+		}
+		if list == "fields" {
+			var items []*lark.GetBitableFieldListRespItem
+			for i, field := range table.Fields {
+				items = append(items, &lark.GetBitableFieldListRespItem{
+					FieldID: fmt.Sprintf("fld%d", i), FieldName: field, Type: 1,
+				})
+			}
+			items, next, hasMore := page(items, r, s.PageSize)
+			writeData(w, &lark.GetBitableFieldListResp{Items: items, PageToken: next, HasMore: hasMore})
+			return
+		}
+		var items []*lark.GetBitableRecordListRespItem
+		for i, record := range table.Records {
+			fields := make(map[string]interface{})
+			for j, value := range record {
+				if j < len(table.Fields) && value != "" {
+					fields[table.Fields[j]] = value
+				}
+			}
+			items = append(items, &lark.GetBitableRecordListRespItem{
+				RecordID: fmt.Sprintf("rec%d", i), Fields: fields,
+			})
+		}
+		items, next, hasMore := page(items, r, s.PageSize)
+		writeData(w, &lark.GetBitableRecordListResp{Items: items, PageToken: next, HasMore: hasMore})
+		return
+	}
+	writeNotFound(w, fmt.Errorf("table %s not found", tableID))
+}
+
+// createExportTask completes the export at once, the ticket being the token
+func (s *Server) createExportTask(w http.ResponseWriter, r *http.Request) {
+	req := &lark.CreateDriveExportTaskReq{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	if _, _, err := s.Source.ExportFile(r.Context(), req.Token, req.Type, req.FileExtension); err != nil {
+		writeNotFound(w, err)
+		return
+	}
+	writeData(w, &lark.CreateDriveExportTaskResp{Ticket: req.Token})
+}
+
+func (s *Server) getExportTask(w http.ResponseWriter, r *http.Request, ticket string) {
+	file, ok := s.Source.Exports[ticket]
+	if !ok {
+		writeNotFound(w, fmt.Errorf("export task %s not found", ticket))
+		return
+	}
+	ext := filepath.Ext(file.Name)
+	writeData(w, &lark.GetDriveExportTaskResp{
+		Result: &lark.GetDriveExportTaskRespResult{
+			FileExtension: strings.TrimPrefix(ext, "."),
+			FileName:      strings.TrimSuffix(file.Name, ext),
+			FileToken:     ticket,
+			FileSize:      int64(len(file.Data)),
+			JobStatus:     0,
+		},
+	})
+}
+
+func (s *Server) downloadExport(w http.ResponseWriter, r *http.Request, fileToken string) {
+	file, ok := s.Source.Exports[fileToken]
+	if !ok {
+		writeError(w, http.StatusNotFound, 1061004, "file not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(file.Data)
+}
+
+// page returns the items of the page requested by the page_token query,
+// where the page token is the offset of the first item.
+func page[T any](items []T, r *http.Request, pageSize int) ([]T, string, bool) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("page_token"))
+	if start > len(items) {
+		start = len(items)
+	}
+	if pageSize <= 0 || start+pageSize >= len(items) {
+		return items[start:], "", false
+	}
+	end := start + pageSize
+	return items[start:end], strconv.Itoa(end), true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	writeJSON(w, map[string]interface{}{"code": 0, "msg": "success", "data": data})
+}
+
+func writeError(w http.ResponseWriter, status int, code int64, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": msg})
+}
+
+func writeNotFound(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusNotFound, 404, fmt.Sprint(err))
+}
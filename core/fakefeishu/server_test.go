@@ -0,0 +1,278 @@
+package fakefeishu_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/core/fakefeishu"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*fakefeishu.Server, *core.Client) {
+	server, err := fakefeishu.NewServerFromDir(filepath.Join(utils.RootDir(), "testdata", "fakefeishu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server, core.NewClient("cli_fake", "secret", core.WithBaseURL(server.URL))
+}
+
+// countRequests counts the requests of "METHOD /path", whatever the query
+func countRequests(server *fakefeishu.Server, request string) int {
+	n := 0
+	for _, r := range server.Requests() {
+		if r == request || strings.HasPrefix(r, request+"?") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestClientPagination(t *testing.T) {
+	server, client := newTestServer(t)
+	server.PageSize = 1
+	ctx := context.Background()
+
+	docx, blocks, err := client.GetDocxContent(ctx, "doxcnFakeReleaseNotes000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "Release Notes", docx.Title)
+	assert.Len(t, blocks, 4)
+	assert.Equal(t, 4, countRequests(server,
+		"GET /open-apis/docx/v1/documents/doxcnFakeReleaseNotes000001/blocks"))
+
+	folderToken := "fldcnFakeRoot"
+	files, err := client.GetDriveFolderFileList(ctx, nil, &folderToken)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	parentNodeToken := "wikcnFakeReleaseNotes"
+	nodes, err := client.GetWikiNodeList(ctx, "7100000000000000001", &parentNodeToken)
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+}
+
+func TestClientDownloadImage(t *testing.T) {
+	_, client := newTestServer(t)
+
+	filename, data, err := client.DownloadImageRaw(context.Background(), "boxcnFakeDiagram0000000001", "static")
+	assert.NoError(t, err)
+	assert.Equal(t, "static/boxcnFakeDiagram0000000001.png", filename)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n"), data)
+}
+
+func TestClientObjects(t *testing.T) {
+	server, client := newTestServer(t)
+	server.PageSize = 1
+	ctx := context.Background()
+
+	// the rows are read in chunks
+	rowsPerRequest := core.SheetRowsPerRequest
+	core.SheetRowsPerRequest = 2
+	t.Cleanup(func() { core.SheetRowsPerRequest = rowsPerRequest })
+	sheets, err := client.GetSheets(ctx, "shtcnFakeBudget")
+	assert.NoError(t, err)
+	if assert.Len(t, sheets, 2) {
+		assert.Equal(t, "2024", sheets[0].Title)
+		assert.Equal(t, [][]string{{"Item", "Cost"}, {"Servers", "1200.5"}, {"Domains, DNS", "30"}}, sheets[0].Values)
+		assert.Len(t, sheets[1].Values, 2)
+	}
+	ranges := 0
+	for _, r := range server.Requests() {
+		if strings.HasPrefix(r, "GET /open-apis/sheets/v2/spreadsheets/shtcnFakeBudget/values/") {
+			ranges++
+		}
+	}
+	assert.Equal(t, 3, ranges)
+
+	tables, err := client.GetBitableTables(ctx, "bascnFakeRoadmap")
+	assert.NoError(t, err)
+	if assert.Len(t, tables, 1) {
+		assert.Equal(t, []string{"Milestone", "Status"}, tables[0].Fields)
+		assert.Len(t, tables[0].Records, 2)
+	}
+
+	name, _, err := client.ExportFile(ctx, "shtcnFakeBudget", "sheet", "xlsx")
+	assert.NoError(t, err)
+	assert.Equal(t, ".xlsx", filepath.Ext(name))
+
+	name, data, err := client.DownloadFile(ctx, "boxcnFakeManual")
+	assert.NoError(t, err)
+	assert.Equal(t, ".pdf", filepath.Ext(name))
+	assert.NotEmpty(t, data)
+
+	name, err = client.GetUserName(ctx, "ou_fake_alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", name)
+	_, err = client.GetUserName(ctx, "ou_fake_nobody")
+	assert.ErrorIs(t, err, core.ErrNotFound)
+}
+
+func TestClientTask(t *testing.T) {
+	server, client := newTestServer(t)
+
+	task, err := client.GetDocxTask(context.Background(), "doxcnFakeReleaseNotes000001", "doxcnFakeTaskBlock000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "Ship the release", task.Summary)
+	assert.False(t, task.Done())
+	assert.Equal(t, []string{"ou_fake_alice"}, task.Assignees())
+	assert.Equal(t, "2024-03-08", task.DueDate())
+	assert.Equal(t, 1, countRequests(server,
+		"GET /open-apis/task/v2/tasks/d300a75f-c56a-4be9-80d1-e47653028ceb"))
+
+	_, err = client.GetDocxTask(context.Background(), "doxcnFakeReleaseNotes000001", "doxcnFakeNoTask")
+	assert.ErrorIs(t, err, core.ErrNotFound)
+}
+
+func TestClientErrors(t *testing.T) {
+	server, client := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := client.GetWikiNodeInfo(ctx, "wikcnMissing")
+	assert.Error(t, err)
+
+	assert.ErrorIs(t, err, core.ErrNotFound)
+
+	server.Fail("/open-apis/wiki/v2/spaces/7100000000000000001", http.StatusForbidden, 131006, "permission denied")
+	_, err = client.GetWikiName(ctx, "7100000000000000001")
+	assert.ErrorIs(t, err, core.ErrPermissionDenied)
+	var apiErr *core.APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+		assert.Equal(t, int64(131006), apiErr.Code)
+	}
+	assert.NotEmpty(t, core.ErrorHint(err))
+
+	server.Fail("/open-apis/wiki/v2/spaces/7100000000000000001", 0, 0, "")
+	name, err := client.GetWikiName(ctx, "7100000000000000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "Handbook", name)
+}
+
+func TestClientRetry(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := core.NewClient("cli_fake", "secret",
+		core.WithBaseURL(server.URL),
+		core.WithRetryPolicy(core.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	)
+	ctx := context.Background()
+
+	server.FailTimes("/open-apis/docx/v1/documents/doxcnFakeFaq0000000000001", 2,
+		http.StatusBadRequest, 99991400, "request trigger frequency limit")
+	docx, _, err := client.GetDocxContent(ctx, "doxcnFakeFaq0000000000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "FAQ", docx.Title)
+	assert.Equal(t, 3, countRequests(server, "GET /open-apis/docx/v1/documents/doxcnFakeFaq0000000000001"))
+
+	server.FailTimes("/open-apis/wiki/v2/spaces/7100000000000000001", 3,
+		http.StatusBadGateway, 500, "bad gateway")
+	_, err = client.GetWikiName(ctx, "7100000000000000001")
+	assert.Error(t, err)
+	assert.Equal(t, 3, countRequests(server, "GET /open-apis/wiki/v2/spaces/7100000000000000001"))
+
+	// the export task may have been created before a server error
+	server.FailTimes("/open-apis/drive/v1/export_tasks", 1, http.StatusBadGateway, 500, "bad gateway")
+	_, _, err = client.ExportFile(ctx, "shtcnFakeBudget", "sheet", "xlsx")
+	assert.Error(t, err)
+	assert.Equal(t, 1, countRequests(server, "POST /open-apis/drive/v1/export_tasks"))
+	server.FailTimes("/open-apis/drive/v1/export_tasks", 1,
+		http.StatusBadRequest, 99991400, "request trigger frequency limit")
+	_, _, err = client.ExportFile(ctx, "shtcnFakeBudget", "sheet", "xlsx")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countRequests(server, "POST /open-apis/drive/v1/export_tasks"))
+
+	// permission errors are not retried
+	server.Fail("/open-apis/drive/v1/files", http.StatusForbidden, 1061004, "forbidden")
+	folderToken := "fldcnFakeRoot"
+	_, err = client.GetDriveFolderFileList(ctx, nil, &folderToken)
+	assert.ErrorIs(t, err, core.ErrPermissionDenied)
+	assert.Equal(t, 1, countRequests(server, "GET /open-apis/drive/v1/files"))
+}
+
+func TestClientUserToken(t *testing.T) {
+	server, client := newTestServer(t)
+	ctx := context.Background()
+
+	token, err := client.ExchangeCode(ctx, fakefeishu.AuthorizationCode)
+	assert.NoError(t, err)
+	assert.Equal(t, fakefeishu.UserName, token.Name)
+	assert.Equal(t, server.URL, token.BaseURL)
+	assert.True(t, token.ExpiresAt.After(time.Now()))
+
+	// an expired access token is refreshed before the request
+	token.ExpiresAt = time.Now()
+	var refreshed *core.UserToken
+	userClient := core.NewClient("cli_fake", "secret",
+		core.WithBaseURL(server.URL),
+		core.WithUserToken(token, func(t *core.UserToken) error {
+			refreshed = t
+			return nil
+		}),
+	)
+	docx, _, err := userClient.GetDocxContent(ctx, "doxcnFakeFaq0000000000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "FAQ", docx.Title)
+	if assert.NotNil(t, refreshed) {
+		assert.NotEqual(t, token.AccessToken, refreshed.AccessToken)
+		assert.Equal(t, server.URL, refreshed.BaseURL)
+	}
+
+	// the refresh token can only be used once
+	_, err = client.RefreshUserToken(ctx, token)
+	assert.Error(t, err)
+}
+
+func TestClientCassette(t *testing.T) {
+	server, _ := newTestServer(t)
+	cassette := filepath.Join(t.TempDir(), "cassette.jsonl")
+	newCassetteClient := func(mode string) *core.Client {
+		t.Setenv(core.CassetteEnv, cassette)
+		t.Setenv(core.CassetteModeEnv, mode)
+		httpClient, err := core.NewHTTPClient(core.NewConfig("", "").HTTP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return core.NewClient("cli_fake", "app-secret-value",
+			core.WithBaseURL(server.URL), core.WithHTTPClient(httpClient))
+	}
+	ctx := context.Background()
+	spaceID := "7100000000000000001"
+
+	recorder := newCassetteClient(core.CassetteModeRecord)
+	docx, blocks, err := recorder.GetDocxContent(ctx, "doxcnFakeReleaseNotes000001")
+	assert.NoError(t, err)
+	nodes, err := recorder.GetWikiNodeList(ctx, spaceID, nil)
+	assert.NoError(t, err)
+	_, image, err := recorder.DownloadImageRaw(ctx, "boxcnFakeDiagram0000000001", "static")
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(cassette)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "app-secret-value")
+	assert.NotContains(t, string(data), fakefeishu.TenantAccessToken)
+	// an interaction per line
+	assert.Equal(t, len(server.Requests()), strings.Count(string(data), "\n"))
+
+	// replay without the server
+	server.Close()
+	player := newCassetteClient(core.CassetteModeReplay)
+	docx2, blocks2, err := player.GetDocxContent(ctx, "doxcnFakeReleaseNotes000001")
+	assert.NoError(t, err)
+	assert.Equal(t, docx, docx2)
+	assert.Equal(t, blocks, blocks2)
+	nodes2, err := player.GetWikiNodeList(ctx, spaceID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, nodes, nodes2)
+	_, image2, err := player.DownloadImageRaw(ctx, "boxcnFakeDiagram0000000001", "static")
+	assert.NoError(t, err)
+	assert.Equal(t, image, image2)
+
+	_, _, err = player.GetDocxContent(ctx, "doxcnFakeFaq0000000000001")
+	assert.ErrorIs(t, err, core.ErrNotRecorded)
+}
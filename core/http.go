@@ -0,0 +1,78 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// NewHTTPClient creates the http client for the Open API from the config.
+// Without a proxy in the config, HTTPS_PROXY, HTTP_PROXY and NO_PROXY of
+// the environment are used; NO_PROXY also applies to the configured proxy.
+// The requests are recorded or replayed when CassetteEnv is set.
+func NewHTTPClient(conf HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if conf.Proxy != "" {
+		if _, err := url.Parse(conf.Proxy); err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy %s", conf.Proxy)
+		}
+		noProxy := os.Getenv("NO_PROXY")
+		if noProxy == "" {
+			noProxy = os.Getenv("no_proxy")
+		}
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  conf.Proxy,
+			HTTPSProxy: conf.Proxy,
+			NoProxy:    noProxy,
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	} else {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	if conf.CABundle != "" || conf.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+		if conf.CABundle != "" {
+			pem, err := os.ReadFile(conf.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.Errorf("no certificate found in %s", conf.CABundle)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if path := os.Getenv(CassetteEnv); path != "" {
+		mode := os.Getenv(CassetteModeEnv)
+		if mode == "" {
+			mode = CassetteModeReplay
+		}
+		cassette, err := NewCassette(path, mode, transport)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = cassette
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+		Timeout:   time.Duration(conf.Timeout) * time.Second,
+	}, nil
+}
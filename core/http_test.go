@@ -0,0 +1,74 @@
+package core_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	conf := core.NewConfig("", "").HTTP
+	conf.Proxy = proxy.URL
+	cli, err := core.NewHTTPClient(conf)
+	assert.NoError(t, err)
+
+	resp, err := cli.Get("http://open.feishu.invalid/open-apis/docx/v1/documents/doxcn")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "http://open.feishu.invalid/open-apis/docx/v1/documents/doxcn", proxied)
+
+	t.Setenv("NO_PROXY", "open.feishu.invalid")
+	cli, err = core.NewHTTPClient(conf)
+	assert.NoError(t, err)
+	_, err = cli.Get("http://open.feishu.invalid/open-apis/docx/v1/documents/doxcn")
+	assert.Error(t, err)
+}
+
+func TestNewHTTPClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	conf := core.NewConfig("", "").HTTP
+
+	cli, err := core.NewHTTPClient(conf)
+	assert.NoError(t, err)
+	_, err = cli.Get(server.URL)
+	assert.Error(t, err)
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: server.Certificate().Raw,
+	}), 0o644)
+	assert.NoError(t, err)
+	conf.CABundle = caBundle
+	cli, err = core.NewHTTPClient(conf)
+	assert.NoError(t, err)
+	resp, err := cli.Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	conf.CABundle = ""
+	conf.InsecureSkipVerify = true
+	cli, err = core.NewHTTPClient(conf)
+	assert.NoError(t, err)
+	resp, err = cli.Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	conf.CABundle = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = core.NewHTTPClient(conf)
+	assert.Error(t, err)
+}
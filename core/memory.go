@@ -0,0 +1,412 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// MemoryFile is an image or attachment served by MemorySource
+type MemoryFile struct {
+	Name string
+	Data []byte
+}
+
+// MemorySource is an in-memory DocSource, typically filled from the json
+// dumps of documents, so that the export can run without the Open API.
+type MemorySource struct {
+	Documents  map[string]*DocxDump
+	Comments   map[string][]*DocxComment
+	Tasks      map[string]*DocxTask
+	Users      map[string]string
+	Files      map[string]*MemoryFile
+	Folders    map[string][]*lark.GetDriveFileListRespFile
+	Metas      map[string]*lark.GetDriveFileMetaRespMeta
+	WikiSpaces map[string]string
+	WikiNodes  []*lark.GetWikiNodeListRespItem
+	Sheets     map[string][]*Sheet
+	Bitables   map[string][]*BitableTable
+	Exports    map[string]*MemoryFile
+}
+
+var _ DocSource = (*MemorySource)(nil)
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		Documents:  make(map[string]*DocxDump),
+		Comments:   make(map[string][]*DocxComment),
+		Tasks:      make(map[string]*DocxTask),
+		Users:      make(map[string]string),
+		Files:      make(map[string]*MemoryFile),
+		Folders:    make(map[string][]*lark.GetDriveFileListRespFile),
+		Metas:      make(map[string]*lark.GetDriveFileMetaRespMeta),
+		WikiSpaces: make(map[string]string),
+		Sheets:     make(map[string][]*Sheet),
+		Bitables:   make(map[string][]*BitableTable),
+		Exports:    make(map[string]*MemoryFile),
+	}
+}
+
+// ReadDocxDump reads a json file written by `download --dump`
+func ReadDocxDump(dumpPath string) (*DocxDump, error) {
+	file, err := os.ReadFile(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	dump := &DocxDump{}
+	if err = json.Unmarshal(file, dump); err != nil {
+		return nil, err
+	}
+	if dump.Document == nil {
+		return nil, errors.Errorf("no document found in %s", dumpPath)
+	}
+	return dump, nil
+}
+
+// LoadDocxDump adds the dumped document and returns its document id
+func (m *MemorySource) LoadDocxDump(dumpPath string) (string, error) {
+	dump, err := ReadDocxDump(dumpPath)
+	if err != nil {
+		return "", err
+	}
+	m.Documents[dump.Document.DocumentID] = dump
+	return dump.Document.DocumentID, nil
+}
+
+// LoadDir fills the source from a fixture directory laid out as
+//
+//	docx/<document_id>.json      documents dumped by `download --dump`
+//	comments/<document_id>.json  comments of a document
+//	task/<block_id>.json         task of a task block
+//	user/<open_id>.json          {"name": ...} of a user
+//	drive/<folder_token>.json    files of a drive folder
+//	meta/<token>.json            owner and modified time of a document
+//	wiki/<space_id>.json         {"name": ..., "nodes": [...]} of a wiki space
+//	sheet/<token>.json           worksheets of a spreadsheet
+//	bitable/<app_token>.json     tables of a bitable
+//	media/<file_token>.<ext>     images, attachments and uploaded files
+//	export/<token>.<ext>         files exported by an export task
+//
+// Missing sub directories are skipped.
+func (m *MemorySource) LoadDir(dir string) error {
+	readJSON := func(sub string, fn func(token string, data []byte) error) error {
+		paths, err := filepath.Glob(filepath.Join(dir, sub, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			token := strings.TrimSuffix(filepath.Base(p), ".json")
+			if err = fn(token, data); err != nil {
+				return errors.Wrapf(err, "failed to load %s", p)
+			}
+		}
+		return nil
+	}
+
+	err := readJSON("docx", func(token string, data []byte) error {
+		dump := &DocxDump{}
+		if err := json.Unmarshal(data, dump); err != nil {
+			return err
+		}
+		if dump.Document == nil {
+			return errors.New("no document found")
+		}
+		m.Documents[dump.Document.DocumentID] = dump
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("comments", func(token string, data []byte) error {
+		var comments []*DocxComment
+		if err := json.Unmarshal(data, &comments); err != nil {
+			return err
+		}
+		m.Comments[token] = comments
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("task", func(token string, data []byte) error {
+		task := &DocxTask{}
+		if err := json.Unmarshal(data, task); err != nil {
+			return err
+		}
+		m.Tasks[token] = task
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("user", func(token string, data []byte) error {
+		var user struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		m.Users[token] = user.Name
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("drive", func(token string, data []byte) error {
+		var files []*lark.GetDriveFileListRespFile
+		if err := json.Unmarshal(data, &files); err != nil {
+			return err
+		}
+		m.Folders[token] = files
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("meta", func(token string, data []byte) error {
+		meta := &lark.GetDriveFileMetaRespMeta{}
+		if err := json.Unmarshal(data, meta); err != nil {
+			return err
+		}
+		meta.DocToken = token
+		m.Metas[token] = meta
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("wiki", func(token string, data []byte) error {
+		var space struct {
+			Name  string                          `json:"name"`
+			Nodes []*lark.GetWikiNodeListRespItem `json:"nodes"`
+		}
+		if err := json.Unmarshal(data, &space); err != nil {
+			return err
+		}
+		m.WikiSpaces[token] = space.Name
+		for _, n := range space.Nodes {
+			n.SpaceID = token
+		}
+		m.WikiNodes = append(m.WikiNodes, space.Nodes...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readJSON("sheet", func(token string, data []byte) error {
+		var sheets []*Sheet
+		if err := json.Unmarshal(data, &sheets); err != nil {
+			return err
+		}
+		m.Sheets[token] = sheets
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSON("bitable", func(token string, data []byte) error {
+		var tables []*BitableTable
+		if err := json.Unmarshal(data, &tables); err != nil {
+			return err
+		}
+		m.Bitables[token] = tables
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	readFiles := func(sub string, files map[string]*MemoryFile) error {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(dir, sub, e.Name()))
+			if err != nil {
+				return err
+			}
+			token := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+			files[token] = &MemoryFile{Name: e.Name(), Data: data}
+		}
+		return nil
+	}
+	if err = readFiles("media", m.Files); err != nil {
+		return err
+	}
+	return readFiles("export", m.Exports)
+}
+
+func (m *MemorySource) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
+	filename, data, err := m.DownloadImageRaw(ctx, imgToken, outDir)
+	if err != nil {
+		return imgToken, err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return imgToken, err
+	}
+	if err = os.WriteFile(filename, data, 0o666); err != nil {
+		return imgToken, err
+	}
+	return filename, nil
+}
+
+func (m *MemorySource) DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error) {
+	file, ok := m.Files[imgToken]
+	if !ok {
+		return imgToken, nil, fmt.Errorf("file %s not found", imgToken)
+	}
+	filename := fmt.Sprintf("%s/%s%s", imgDir, imgToken, filepath.Ext(file.Name))
+	return filename, file.Data, nil
+}
+
+func (m *MemorySource) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	dump, ok := m.Documents[docToken]
+	if !ok {
+		return nil, nil, fmt.Errorf("document %s not found", docToken)
+	}
+	return dump.Document, dump.Blocks, nil
+}
+
+func (m *MemorySource) GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error) {
+	docx, _, err := m.GetDocxContent(ctx, docToken)
+	return docx, err
+}
+
+func (m *MemorySource) GetDocxBlocks(ctx context.Context, documentID string) ([]*lark.DocxBlock, error) {
+	_, blocks, err := m.GetDocxContent(ctx, documentID)
+	return blocks, err
+}
+
+func (m *MemorySource) GetDocxComments(ctx context.Context, docToken string) ([]*DocxComment, error) {
+	return m.Comments[docToken], nil
+}
+
+// GetDocxTask returns the task of a task block, from the dump of the
+// document or else from the tasks of the source
+func (m *MemorySource) GetDocxTask(ctx context.Context, docToken, blockID string) (*DocxTask, error) {
+	if dump, ok := m.Documents[docToken]; ok {
+		if task, ok := dump.Tasks[blockID]; ok {
+			return task, nil
+		}
+	}
+	task, ok := m.Tasks[blockID]
+	if !ok {
+		return nil, fmt.Errorf("task of block %s not found", blockID)
+	}
+	return task, nil
+}
+
+func (m *MemorySource) GetUserName(ctx context.Context, userID string) (string, error) {
+	name, ok := m.Users[userID]
+	if !ok {
+		return "", fmt.Errorf("user %s not found", userID)
+	}
+	return name, nil
+}
+
+func (m *MemorySource) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error) {
+	for _, n := range m.WikiNodes {
+		if n.NodeToken == token {
+			return &lark.GetWikiNodeRespNode{
+				SpaceID:         n.SpaceID,
+				NodeToken:       n.NodeToken,
+				ObjToken:        n.ObjToken,
+				ObjType:         n.ObjType,
+				ParentNodeToken: n.ParentNodeToken,
+				NodeType:        n.NodeType,
+				OriginNodeToken: n.OriginNodeToken,
+				OriginSpaceID:   n.OriginSpaceID,
+				HasChild:        n.HasChild,
+				Title:           n.Title,
+				ObjCreateTime:   n.ObjCreateTime,
+				ObjEditTime:     n.ObjEditTime,
+				NodeCreateTime:  n.NodeCreateTime,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("wiki node %s not found", token)
+}
+
+func (m *MemorySource) GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error) {
+	files, ok := m.Folders[*folderToken]
+	if !ok {
+		return nil, fmt.Errorf("folder %s not found", *folderToken)
+	}
+	return files, nil
+}
+
+func (m *MemorySource) GetDriveFileMetas(ctx context.Context, docs []*lark.GetDriveFileMetaReqRequestDocs) ([]*lark.GetDriveFileMetaRespMeta, error) {
+	var metas []*lark.GetDriveFileMetaRespMeta
+	for _, doc := range docs {
+		if meta, ok := m.Metas[doc.DocToken]; ok {
+			metas = append(metas, meta)
+		}
+	}
+	return metas, nil
+}
+
+func (m *MemorySource) GetWikiName(ctx context.Context, spaceID string) (string, error) {
+	name, ok := m.WikiSpaces[spaceID]
+	if !ok {
+		return "", fmt.Errorf("wiki space %s not found", spaceID)
+	}
+	return name, nil
+}
+
+func (m *MemorySource) GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*lark.GetWikiNodeListRespItem, error) {
+	parent := ""
+	if parentNodeToken != nil {
+		parent = *parentNodeToken
+	}
+	var nodes []*lark.GetWikiNodeListRespItem
+	for _, n := range m.WikiNodes {
+		if n.SpaceID == spaceID && n.ParentNodeToken == parent {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+func (m *MemorySource) GetSheets(ctx context.Context, spreadsheetToken string) ([]*Sheet, error) {
+	sheets, ok := m.Sheets[spreadsheetToken]
+	if !ok {
+		return nil, fmt.Errorf("spreadsheet %s not found", spreadsheetToken)
+	}
+	return sheets, nil
+}
+
+func (m *MemorySource) GetBitableTables(ctx context.Context, appToken string) ([]*BitableTable, error) {
+	tables, ok := m.Bitables[appToken]
+	if !ok {
+		return nil, fmt.Errorf("bitable %s not found", appToken)
+	}
+	return tables, nil
+}
+
+func (m *MemorySource) ExportFile(ctx context.Context, token, objType, ext string) (string, []byte, error) {
+	file, ok := m.Exports[token]
+	if !ok || filepath.Ext(file.Name) != "."+ext {
+		return "", nil, fmt.Errorf("export of %s %s not found", objType, token)
+	}
+	return file.Name, file.Data, nil
+}
+
+func (m *MemorySource) DownloadFile(ctx context.Context, fileToken string) (string, []byte, error) {
+	file, ok := m.Files[fileToken]
+	if !ok {
+		return "", nil, fmt.Errorf("file %s not found", fileToken)
+	}
+	return file.Name, file.Data, nil
+}
@@ -0,0 +1,346 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chyroc/lark"
+)
+
+// Sheet is a worksheet of a spreadsheet with the text of its cells
+type Sheet struct {
+	SheetID string     `json:"sheet_id"`
+	Title   string     `json:"title"`
+	Values  [][]string `json:"values"`
+}
+
+// BitableTable is a table of a bitable with the text of its records in the
+// order of the fields
+type BitableTable struct {
+	TableID string     `json:"table_id"`
+	Name    string     `json:"name"`
+	Fields  []string   `json:"fields"`
+	Records [][]string `json:"records"`
+}
+
+// SheetRowsPerRequest is the number of rows read by a request of the sheet
+// values, which are limited in size by the API
+var SheetRowsPerRequest int64 = 1000
+
+// exportPollInterval is the interval to check whether an export task is done
+var exportPollInterval = time.Second
+
+const exportMaxPolls = 120
+
+func (c *Client) GetSheets(ctx context.Context, spreadsheetToken string) ([]*Sheet, error) {
+	type valueReq struct {
+		SpreadSheetToken     string `path:"spreadsheetToken" json:"-"`
+		Range                string `path:"range" json:"-"`
+		ValueRenderOption    string `query:"valueRenderOption" json:"-"`
+		DateTimeRenderOption string `query:"dateTimeRenderOption" json:"-"`
+	}
+	// the lark SDK fails on the decimal cells, so the values are decoded here
+	type valueResp struct {
+		Code int64  `json:"code,omitempty"`
+		Msg  string `json:"msg,omitempty"`
+		Data *struct {
+			ValueRange *struct {
+				Values [][]interface{} `json:"values,omitempty"`
+			} `json:"valueRange,omitempty"`
+		} `json:"data,omitempty"`
+	}
+
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := c.larkClient.Drive.GetSheetList(ctx, &lark.GetSheetListReq{
+		SpreadSheetToken: spreadsheetToken,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	methodOption := &lark.MethodOption{}
+	for _, opt := range opts {
+		opt(methodOption)
+	}
+
+	var sheets []*Sheet
+	for _, s := range resp.Sheets {
+		if s.ResourceType != "" && s.ResourceType != "sheet" {
+			continue
+		}
+		sheet := &Sheet{SheetID: s.SheetID, Title: s.Title}
+		sheets = append(sheets, sheet)
+		grid := s.GridProperties
+		if grid == nil || grid.RowCount == 0 || grid.ColumnCount == 0 {
+			continue
+		}
+		for start := int64(1); start <= grid.RowCount; start += SheetRowsPerRequest {
+			end := start + SheetRowsPerRequest - 1
+			if end > grid.RowCount {
+				end = grid.RowCount
+			}
+			valueRange := fmt.Sprintf("%s!A%d:%s%d", s.SheetID, start, columnName(grid.ColumnCount), end)
+			resp := new(valueResp)
+			_, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+				Scope:  "Drive",
+				API:    "GetSheetValue",
+				Method: "GET",
+				URL:    c.openBaseURL + "/open-apis/sheets/v2/spreadsheets/:spreadsheetToken/values/:range",
+				Body: &valueReq{
+					SpreadSheetToken:     spreadsheetToken,
+					Range:                valueRange,
+					ValueRenderOption:    "ToString",
+					DateTimeRenderOption: "FormattedString",
+				},
+				MethodOption:          methodOption,
+				NeedTenantAccessToken: true,
+				NeedUserAccessToken:   c.userToken != nil,
+			}, resp)
+			if err != nil {
+				return nil, err
+			}
+			var values [][]interface{}
+			if resp.Data != nil && resp.Data.ValueRange != nil {
+				values = resp.Data.ValueRange.Values
+			}
+			// keep the rows of the following chunks in place
+			for i := int64(0); i < end-start+1; i++ {
+				var texts []string
+				if i < int64(len(values)) {
+					texts = make([]string, len(values[i]))
+					for j, v := range values[i] {
+						texts[j] = cellText(v)
+					}
+				}
+				sheet.Values = append(sheet.Values, texts)
+			}
+		}
+		sheet.Values = trimEmptyRows(sheet.Values)
+	}
+	return sheets, nil
+}
+
+func (c *Client) GetBitableTables(ctx context.Context, appToken string) ([]*BitableTable, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*BitableTable
+	var pageToken *string
+	for {
+		resp, _, err := c.larkClient.Bitable.GetBitableTableList(ctx, &lark.GetBitableTableListReq{
+			AppToken:  appToken,
+			PageToken: pageToken,
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			tables = append(tables, &BitableTable{TableID: item.TableID, Name: item.Name})
+		}
+		if !resp.HasMore || resp.PageToken == "" {
+			break
+		}
+		pageToken = &resp.PageToken
+	}
+
+	for _, table := range tables {
+		pageToken = nil
+		for {
+			resp, _, err := c.larkClient.Bitable.GetBitableFieldList(ctx, &lark.GetBitableFieldListReq{
+				AppToken:  appToken,
+				TableID:   table.TableID,
+				PageToken: pageToken,
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range resp.Items {
+				table.Fields = append(table.Fields, item.FieldName)
+			}
+			if !resp.HasMore || resp.PageToken == "" {
+				break
+			}
+			pageToken = &resp.PageToken
+		}
+
+		pageToken = nil
+		for {
+			resp, _, err := c.larkClient.Bitable.GetBitableRecordList(ctx, &lark.GetBitableRecordListReq{
+				AppToken:  appToken,
+				TableID:   table.TableID,
+				PageToken: pageToken,
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range resp.Items {
+				record := make([]string, len(table.Fields))
+				for i, field := range table.Fields {
+					record[i] = cellText(item.Fields[field])
+				}
+				table.Records = append(table.Records, record)
+			}
+			if !resp.HasMore || resp.PageToken == "" {
+				break
+			}
+			pageToken = &resp.PageToken
+		}
+	}
+	return tables, nil
+}
+
+// ExportFile exports a document, sheet or bitable by an export task to a
+// file with the extension, e.g. xlsx, and returns its name and content.
+func (c *Client) ExportFile(ctx context.Context, token, objType, ext string) (string, []byte, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	task, _, err := c.larkClient.Drive.CreateDriveExportTask(ctx, &lark.CreateDriveExportTaskReq{
+		FileExtension: ext,
+		Token:         token,
+		Type:          objType,
+	}, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var result *lark.GetDriveExportTaskRespResult
+	for polls := 0; ; polls++ {
+		resp, _, err := c.larkClient.Drive.GetDriveExportTask(ctx, &lark.GetDriveExportTaskReq{
+			Ticket: task.Ticket,
+			Token:  token,
+		}, opts...)
+		if err != nil {
+			return "", nil, err
+		}
+		result = resp.Result
+		if result != nil && result.JobStatus == 0 {
+			break
+		}
+		if result != nil && result.JobStatus != 1 && result.JobStatus != 2 {
+			return "", nil, fmt.Errorf("export %s failed: %s (%d)", token, result.JobErrorMsg, result.JobStatus)
+		}
+		if polls >= exportMaxPolls {
+			return "", nil, fmt.Errorf("export %s timed out", token)
+		}
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-time.After(exportPollInterval):
+		}
+	}
+
+	resp, _, err := c.larkClient.Drive.DownloadDriveExportTask(ctx, &lark.DownloadDriveExportTaskReq{
+		FileToken: result.FileToken,
+	}, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(resp.File); err != nil {
+		return "", nil, err
+	}
+	name := result.FileName
+	if filepath.Ext(name) != "."+ext {
+		name += "." + ext
+	}
+	return name, buf.Bytes(), nil
+}
+
+// DownloadFile downloads an uploaded file of the drive as-is and returns its
+// name and content
+func (c *Client) DownloadFile(ctx context.Context, fileToken string) (string, []byte, error) {
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, _, err := c.larkClient.Drive.DownloadDriveFile(ctx, &lark.DownloadDriveFileReq{
+		FileToken: fileToken,
+	}, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(resp.File); err != nil {
+		return "", nil, err
+	}
+	return resp.Filename, buf.Bytes(), nil
+}
+
+// cellText returns the text of a cell of a sheet or a field of a bitable
+// record, which is a scalar, a segment or a list of them
+func cellText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		texts := make([]string, 0, len(v))
+		for _, item := range v {
+			texts = append(texts, cellText(item))
+		}
+		// the segments of a rich text are joined, the options are listed
+		if len(v) > 0 {
+			if segment, ok := v[0].(map[string]interface{}); ok && segment["type"] != nil {
+				return strings.Join(texts, "")
+			}
+		}
+		return strings.Join(texts, ", ")
+	case map[string]interface{}:
+		for _, key := range []string{"text", "name", "full_address", "link", "url"} {
+			if s, ok := v[key].(string); ok {
+				return s
+			}
+		}
+		if value, ok := v["value"]; ok {
+			return cellText(value)
+		}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// columnName returns the letters of the nth column, e.g. A for 1, AA for 27
+func columnName(n int64) string {
+	name := ""
+	for n > 0 {
+		n--
+		name = string(rune('A'+n%26)) + name
+		n /= 26
+	}
+	return name
+}
+
+// trimEmptyRows drops the empty rows at the end of the grid
+func trimEmptyRows(rows [][]string) [][]string {
+	for len(rows) > 0 {
+		empty := true
+		for _, cell := range rows[len(rows)-1] {
+			if cell != "" {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			break
+		}
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
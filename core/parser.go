@@ -2,32 +2,91 @@ package core
 
 import (
 	"fmt"
+	"html"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/88250/lute/render"
 	"github.com/Wsine/feishu2md/utils"
 	"github.com/chyroc/lark"
 	"github.com/olekukonko/tablewriter"
 )
 
 type Parser struct {
-	useHTMLTags bool
-	ImgTokens   []string
-	blockMap    map[string]*lark.DocxBlock
+	useHTMLTags    bool
+	commentStyle   string
+	mathDialect    string
+	toc            bool
+	slugStyle      string
+	codeLangMap    map[lark.DocxCodeLanguage]string
+	ImgTokens      []string
+	Todos          []*TodoItem
+	HeadingSlugs   map[string]string
+	headings       []*docxHeading
+	blockMap       map[string]*lark.DocxBlock
+	comments       []*DocxComment
+	commentAnchors map[string]int
+	userNames      map[string]string
+	tasks          map[string]*DocxTask
 }
 
 func NewParser(config OutputConfig) *Parser {
 	return &Parser{
-		useHTMLTags: config.UseHTMLTags,
-		ImgTokens:   make([]string, 0),
-		blockMap:    make(map[string]*lark.DocxBlock),
+		useHTMLTags:    config.UseHTMLTags,
+		commentStyle:   config.CommentStyle,
+		mathDialect:    config.MathDialect,
+		toc:            config.TOC,
+		slugStyle:      config.SlugStyle,
+		codeLangMap:    NewCodeLangMap(config.CodeLanguageMap),
+		ImgTokens:      make([]string, 0),
+		Todos:          make([]*TodoItem, 0),
+		HeadingSlugs:   make(map[string]string),
+		blockMap:       make(map[string]*lark.DocxBlock),
+		commentAnchors: make(map[string]int),
 	}
 }
 
+// SetComments attaches the document comments to be rendered according to
+// the comment style of the output config.
+func (p *Parser) SetComments(comments []*DocxComment) {
+	p.comments = comments
+}
+
+// SetUserNames sets the names of the comment authors and todo owners by
+// open id. The open ids are written for the users without a name.
+func (p *Parser) SetUserNames(names map[string]string) {
+	p.userNames = names
+}
+
+// SetTasks sets the Feishu tasks of the task blocks by block id. The task
+// blocks without a task are written as a note.
+func (p *Parser) SetTasks(tasks map[string]*DocxTask) {
+	p.tasks = tasks
+}
+
 // =============================================================
 // Parser utils
 // =============================================================
 
+// Code languages of the Feishu docx enum that are not defined by the lark SDK
+const (
+	DocxCodeLanguageCMake      lark.DocxCodeLanguage = 68
+	DocxCodeLanguageDiff       lark.DocxCodeLanguage = 69
+	DocxCodeLanguageGherkin    lark.DocxCodeLanguage = 70
+	DocxCodeLanguageGraphQL    lark.DocxCodeLanguage = 71
+	DocxCodeLanguageGLSL       lark.DocxCodeLanguage = 72
+	DocxCodeLanguageProperties lark.DocxCodeLanguage = 73
+	DocxCodeLanguageSolidity   lark.DocxCodeLanguage = 74
+	DocxCodeLanguageTOML       lark.DocxCodeLanguage = 75
+)
+
+// DocxBlockTypeTask is the task block of Feishu tasks, missing from the sdk.
+// The sdk decodes the block without its task id, see Client.GetDocxTask.
+const DocxBlockTypeTask lark.DocxBlockType = 35
+
 var DocxCodeLang2MdStr = map[lark.DocxCodeLanguage]string{
 	lark.DocxCodeLanguagePlainText:    "",
 	lark.DocxCodeLanguageABAP:         "abap",
@@ -96,6 +155,37 @@ var DocxCodeLang2MdStr = map[lark.DocxCodeLanguage]string{
 	lark.DocxCodeLanguageVisual:       "vbnet",
 	lark.DocxCodeLanguageXML:          "xml",
 	lark.DocxCodeLanguageYAML:         "yaml",
+	DocxCodeLanguageCMake:             "cmake",
+	DocxCodeLanguageDiff:              "diff",
+	DocxCodeLanguageGherkin:           "gherkin",
+	DocxCodeLanguageGraphQL:           "graphql",
+	DocxCodeLanguageGLSL:              "glsl",
+	DocxCodeLanguageProperties:        "properties",
+	DocxCodeLanguageSolidity:          "solidity",
+	DocxCodeLanguageTOML:              "toml",
+}
+
+// NewCodeLangMap returns DocxCodeLang2MdStr with the user overrides applied.
+// An override key is either the numeric Feishu language enum, which also
+// allows adding languages unknown to this tool, or a default fence name
+// such as "shell".
+func NewCodeLangMap(overrides map[string]string) map[lark.DocxCodeLanguage]string {
+	langMap := make(map[lark.DocxCodeLanguage]string, len(DocxCodeLang2MdStr))
+	for lang, name := range DocxCodeLang2MdStr {
+		langMap[lang] = name
+	}
+	for key, name := range overrides {
+		if n, err := strconv.Atoi(key); err == nil {
+			langMap[lark.DocxCodeLanguage(n)] = name
+			continue
+		}
+		for lang, defaultName := range DocxCodeLang2MdStr {
+			if defaultName != "" && strings.EqualFold(defaultName, key) {
+				langMap[lang] = name
+			}
+		}
+	}
+	return langMap
 }
 
 func renderMarkdownTable(data [][]string) string {
@@ -122,7 +212,16 @@ func (p *Parser) ParseDocxContent(doc *lark.DocxDocument, blocks []*lark.DocxBlo
 	}
 
 	entryBlock := p.blockMap[doc.DocumentID]
-	return p.ParseDocxBlock(entryBlock, 0)
+	p.collectHeadings(entryBlock, utils.NewSlugger(p.slugStyle))
+	markdown := p.ParseDocxBlock(entryBlock, 0)
+
+	switch p.commentStyle {
+	case CommentStyleFootnote:
+		markdown = p.renderCommentFootnotes(markdown)
+	case CommentStyleAppendix:
+		markdown += p.renderCommentAppendix()
+	}
+	return markdown
 }
 
 func (p *Parser) ParseDocxBlock(b *lark.DocxBlock, indentLevel int) string {
@@ -158,23 +257,16 @@ func (p *Parser) ParseDocxBlock(b *lark.DocxBlock, indentLevel int) string {
 	case lark.DocxBlockTypeOrdered:
 		buf.WriteString(p.ParseDocxBlockOrdered(b, indentLevel))
 	case lark.DocxBlockTypeCode:
-		buf.WriteString("```" + DocxCodeLang2MdStr[b.Code.Style.Language] + "\n")
-		buf.WriteString(strings.TrimSpace(p.ParseDocxBlockText(b.Code)))
-		buf.WriteString("\n```\n")
+		buf.WriteString(p.ParseDocxBlockCode(b.Code))
 	case lark.DocxBlockTypeQuote:
 		buf.WriteString("> ")
 		buf.WriteString(p.ParseDocxBlockText(b.Quote))
 	case lark.DocxBlockTypeEquation:
-		buf.WriteString("$$\n")
-		buf.WriteString(p.ParseDocxBlockText(b.Equation))
-		buf.WriteString("\n$$\n")
+		buf.WriteString(p.ParseDocxBlockEquation(b.Equation))
 	case lark.DocxBlockTypeTodo:
-		if b.Todo.Style.Done {
-			buf.WriteString("- [x] ")
-		} else {
-			buf.WriteString("- [ ] ")
-		}
-		buf.WriteString(p.ParseDocxBlockText(b.Todo))
+		buf.WriteString(p.ParseDocxBlockTodo(b.Todo))
+	case DocxBlockTypeTask:
+		buf.WriteString(p.ParseDocxBlockTask(b))
 	case lark.DocxBlockTypeDivider:
 		buf.WriteString("---\n")
 	case lark.DocxBlockTypeImage:
@@ -199,6 +291,11 @@ func (p *Parser) ParseDocxBlockPage(b *lark.DocxBlock) string {
 	buf.WriteString(p.ParseDocxBlockText(b.Page))
 	buf.WriteString("\n")
 
+	if p.toc && len(p.headings) > 0 {
+		buf.WriteString(p.renderTOC())
+		buf.WriteString("\n")
+	}
+
 	for _, childId := range b.Children {
 		childBlock := p.blockMap[childId]
 		buf.WriteString(p.ParseDocxBlock(childBlock, 0))
@@ -210,15 +307,36 @@ func (p *Parser) ParseDocxBlockPage(b *lark.DocxBlock) string {
 
 func (p *Parser) ParseDocxBlockText(b *lark.DocxBlockText) string {
 	buf := new(strings.Builder)
-	numElem := len(b.Elements)
-	for _, e := range b.Elements {
-		inline := numElem > 1
-		buf.WriteString(p.ParseDocxTextElement(e, inline))
+	anchors := p.anchorComments(b.Elements)
+	for i, e := range b.Elements {
+		buf.WriteString(p.ParseDocxTextElement(e, true))
+		buf.WriteString(anchors[i])
 	}
 	buf.WriteString("\n")
 	return buf.String()
 }
 
+// ParseDocxBlockCode writes the code fence. The footnote references of the
+// comments on the code follow the fence, so as to keep the code intact.
+func (p *Parser) ParseDocxBlockCode(b *lark.DocxBlockText) string {
+	code := new(strings.Builder)
+	refs := new(strings.Builder)
+	anchors := p.anchorComments(b.Elements)
+	for i, e := range b.Elements {
+		code.WriteString(p.ParseDocxTextElement(e, true))
+		refs.WriteString(anchors[i])
+	}
+
+	buf := new(strings.Builder)
+	buf.WriteString("```" + p.codeLangMap[b.Style.Language] + "\n")
+	buf.WriteString(strings.TrimSpace(code.String()))
+	buf.WriteString("\n```\n")
+	if refs.Len() > 0 {
+		buf.WriteString(refs.String() + "\n")
+	}
+	return buf.String()
+}
+
 func (p *Parser) ParseDocxBlockCallout(b *lark.DocxBlock) string {
 	buf := new(strings.Builder)
 
@@ -241,16 +359,60 @@ func (p *Parser) ParseDocxTextElement(e *lark.DocxTextElement, inline bool) stri
 	}
 	if e.MentionDoc != nil {
 		buf.WriteString(
-			fmt.Sprintf("[%s](%s)", e.MentionDoc.Title, utils.UnescapeURL(e.MentionDoc.URL)))
+			fmt.Sprintf("[%s](%s)", e.MentionDoc.Title, p.resolveLink(e.MentionDoc.URL)))
 	}
 	if e.Equation != nil {
-		symbol := "$$"
+		buf.WriteString(p.renderMath(strings.TrimSuffix(e.Equation.Content, "\n"), inline))
+	}
+	return buf.String()
+}
+
+func (p *Parser) ParseDocxBlockEquation(b *lark.DocxBlockText) string {
+	tex := new(strings.Builder)
+	for _, e := range b.Elements {
+		tex.WriteString(textElementPlainText(e))
+	}
+	return p.renderMath(strings.TrimSpace(tex.String()), false)
+}
+
+const (
+	MathDialectDollar = "dollar"
+	MathDialectLaTeX  = "latex"
+	MathDialectGitLab = "gitlab"
+	MathDialectMathML = "mathml"
+)
+
+// renderMath writes the KaTeX formula in the configured math dialect. The
+// MathML dialect keeps the TeX source as an annotation for HTML renderers,
+// since there is no TeX to MathML converter at hand.
+func (p *Parser) renderMath(tex string, inline bool) string {
+	switch p.mathDialect {
+	case MathDialectLaTeX:
+		if inline {
+			return `\(` + tex + `\)`
+		}
+		return "\\[\n" + tex + "\n\\]\n"
+	case MathDialectGitLab:
+		if inline {
+			return "$`" + tex + "`$"
+		}
+		return "```math\n" + tex + "\n```\n"
+	case MathDialectMathML:
+		display := "inline"
+		if !inline {
+			display = "block"
+		}
+		escaped := html.EscapeString(tex)
+		return fmt.Sprintf(
+			`<math display="%s"><semantics><mtext>%s</mtext><annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+			display, escaped, escaped,
+		)
+	default:
 		if inline {
-			symbol = "$"
+			return "$" + tex + "$"
 		}
-		buf.WriteString(symbol + strings.TrimSuffix(e.Equation.Content, "\n") + symbol)
+		return "$$\n" + tex + "\n$$\n"
 	}
-	return buf.String()
 }
 
 func (p *Parser) ParseDocxTextElementTextRun(tr *lark.DocxTextElementTextRun) string {
@@ -289,7 +451,7 @@ func (p *Parser) ParseDocxTextElementTextRun(tr *lark.DocxTextElementTextRun) st
 			postWrite = "`"
 		} else if link := style.Link; link != nil {
 			buf.WriteString("[")
-			postWrite = fmt.Sprintf("](%s)", utils.UnescapeURL(link.URL))
+			postWrite = fmt.Sprintf("](%s)", p.resolveLink(link.URL))
 		}
 	}
 	buf.WriteString(tr.Content)
@@ -303,8 +465,19 @@ func (p *Parser) ParseDocxBlockHeading(b *lark.DocxBlock, headingLevel int) stri
 	buf.WriteString(strings.Repeat("#", headingLevel))
 	buf.WriteString(" ")
 
-	headingText := reflect.ValueOf(b).Elem().FieldByName(fmt.Sprintf("Heading%d", headingLevel))
-	buf.WriteString(p.ParseDocxBlockText(headingText.Interface().(*lark.DocxBlockText)))
+	// the comments on the heading follow it, out of the text its anchor is
+	// generated from
+	text := docxHeadingText(b, headingLevel)
+	refs := new(strings.Builder)
+	anchors := p.anchorComments(text.Elements)
+	for i, e := range text.Elements {
+		buf.WriteString(p.ParseDocxTextElement(e, true))
+		refs.WriteString(anchors[i])
+	}
+	buf.WriteString("\n")
+	if refs.Len() > 0 {
+		buf.WriteString("\n" + refs.String() + "\n")
+	}
 
 	for _, childId := range b.Children {
 		childBlock := p.blockMap[childId]
@@ -314,6 +487,83 @@ func (p *Parser) ParseDocxBlockHeading(b *lark.DocxBlock, headingLevel int) stri
 	return buf.String()
 }
 
+// TodoItem is an action item of the document, rendered in the format of the
+// Obsidian Tasks plugin.
+type TodoItem struct {
+	Text   string
+	Done   bool
+	Owners []string
+	Due    string
+}
+
+func (t *TodoItem) Markdown() string {
+	buf := new(strings.Builder)
+	if t.Done {
+		buf.WriteString("- [x] ")
+	} else {
+		buf.WriteString("- [ ] ")
+	}
+	buf.WriteString(t.Text)
+	for _, owner := range t.Owners {
+		buf.WriteString(" @" + owner)
+	}
+	if t.Due != "" {
+		buf.WriteString(" 📅 " + t.Due)
+	}
+	return buf.String()
+}
+
+func (p *Parser) ParseDocxBlockTodo(b *lark.DocxBlockText) string {
+	todo := &TodoItem{Done: b.Style != nil && b.Style.Done}
+
+	// Assignees and due dates are written as mentions and reminders within
+	// the todo text, so move them to the suffixes
+	text := &lark.DocxBlockText{Style: b.Style}
+	var dueTime time.Time
+	for _, e := range b.Elements {
+		switch {
+		case e.MentionUser != nil:
+			todo.Owners = append(todo.Owners, p.userName(e.MentionUser.UserID))
+		case e.Reminder != nil:
+			ms, err := strconv.ParseInt(e.Reminder.ExpireTime, 10, 64)
+			if err != nil {
+				continue
+			}
+			if t := time.UnixMilli(ms); dueTime.IsZero() || t.Before(dueTime) {
+				dueTime = t
+			}
+		default:
+			text.Elements = append(text.Elements, e)
+		}
+	}
+	if !dueTime.IsZero() {
+		todo.Due = dueTime.Format("2006-01-02")
+	}
+	todo.Text = strings.TrimSpace(p.ParseDocxBlockText(text))
+	p.Todos = append(p.Todos, todo)
+
+	return todo.Markdown() + "\n"
+}
+
+// ParseDocxBlockTask writes the Feishu task of the block like a todo
+func (p *Parser) ParseDocxBlockTask(b *lark.DocxBlock) string {
+	task, ok := p.tasks[b.BlockID]
+	if !ok {
+		return "<!-- Feishu task not exported, see the original document -->\n"
+	}
+	todo := &TodoItem{
+		Text: strings.TrimSpace(task.Summary),
+		Done: task.Done(),
+		Due:  task.DueDate(),
+	}
+	for _, userID := range task.Assignees() {
+		todo.Owners = append(todo.Owners, p.userName(userID))
+	}
+	p.Todos = append(p.Todos, todo)
+
+	return todo.Markdown() + "\n"
+}
+
 func (p *Parser) ParseDocxBlockImage(img *lark.DocxBlockImage) string {
 	buf := new(strings.Builder)
 	buf.WriteString(fmt.Sprintf("![](%s)", img.Token))
@@ -496,3 +746,318 @@ func (p *Parser) ParseDocxBlockGrid(b *lark.DocxBlock, indentLevel int) string {
 
 	return buf.String()
 }
+
+// =============================================================
+// Render the document comments
+// =============================================================
+
+const (
+	CommentStyleFootnote = "footnote"
+	CommentStyleAppendix = "appendix"
+)
+
+func textElementPlainText(e *lark.DocxTextElement) string {
+	switch {
+	case e.TextRun != nil:
+		return e.TextRun.Content
+	case e.MentionUser != nil:
+		return e.MentionUser.UserID
+	case e.MentionDoc != nil:
+		return e.MentionDoc.Title
+	case e.Equation != nil:
+		return e.Equation.Content
+	}
+	return ""
+}
+
+// anchorComments looks for the quoted text of the pending comments in the
+// elements and returns the footnote references to write after each element.
+func (p *Parser) anchorComments(elements []*lark.DocxTextElement) map[int]string {
+	if p.commentStyle != CommentStyleFootnote || len(p.comments) == len(p.commentAnchors) {
+		return nil
+	}
+
+	plain := new(strings.Builder)
+	ends := make([]int, len(elements))
+	for i, e := range elements {
+		plain.WriteString(textElementPlainText(e))
+		ends[i] = plain.Len()
+	}
+
+	anchors := make(map[int]string)
+	for _, comment := range p.comments {
+		if _, ok := p.commentAnchors[comment.CommentID]; ok || comment.IsWhole || comment.Quote == "" {
+			continue
+		}
+		idx := strings.Index(plain.String(), comment.Quote)
+		if idx < 0 {
+			continue
+		}
+		end := idx + len(comment.Quote)
+		for i := range elements {
+			if ends[i] >= end {
+				p.commentAnchors[comment.CommentID] = len(p.commentAnchors) + 1
+				anchors[i] += fmt.Sprintf("[^%d]", p.commentAnchors[comment.CommentID])
+				break
+			}
+		}
+	}
+	return anchors
+}
+
+// userName returns the name of the user, or the open id without a name
+func (p *Parser) userName(userID string) string {
+	if name := p.userNames[userID]; name != "" {
+		return name
+	}
+	return userID
+}
+
+// commentHeader returns the bold author followed by the details, leaving
+// out the author of an anonymous comment
+func (p *Parser) commentHeader(userID string, details ...string) string {
+	var header []string
+	if name := p.userName(userID); name != "" {
+		header = append(header, "**"+name+"**")
+	}
+	for _, detail := range details {
+		if detail != "" {
+			header = append(header, detail)
+		}
+	}
+	return strings.Join(header, " ")
+}
+
+func (p *Parser) renderCommentReply(reply *lark.GetDriveCommentListRespItemReplyListReply, status string) string {
+	buf := new(strings.Builder)
+	if status != "" {
+		status = "(" + status + ")"
+	}
+	buf.WriteString(p.commentHeader(reply.UserID,
+		time.Unix(reply.CreateTime, 0).Format("2006-01-02 15:04"), status))
+	buf.WriteString(": ")
+	if reply.Content != nil {
+		for _, e := range reply.Content.Elements {
+			switch {
+			case e.TextRun != nil:
+				buf.WriteString(e.TextRun.Text)
+			case e.DocsLink != nil:
+				buf.WriteString(utils.UnescapeURL(e.DocsLink.URL))
+			case e.Person != nil:
+				buf.WriteString("@" + p.userName(e.Person.UserID))
+			}
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// renderComment returns the comment followed by its replies, one per line
+func (p *Parser) renderComment(comment *DocxComment) []string {
+	status := "unresolved"
+	if comment.IsSolved {
+		status = "resolved"
+	}
+	if comment.ReplyList == nil || len(comment.ReplyList.Replies) == 0 {
+		return []string{p.commentHeader(comment.UserID, "("+status+")")}
+	}
+	var lines []string
+	for i, reply := range comment.ReplyList.Replies {
+		if i == 0 {
+			lines = append(lines, p.renderCommentReply(reply, status))
+		} else {
+			lines = append(lines, p.renderCommentReply(reply, ""))
+		}
+	}
+	return lines
+}
+
+// CommentUserIDs returns the open ids of the comment authors and of the
+// users mentioned in the comments, to look up their names
+func CommentUserIDs(comments []*DocxComment) []string {
+	seen := make(map[string]bool)
+	var userIDs []string
+	add := func(userID string) {
+		if userID != "" && !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	for _, comment := range comments {
+		add(comment.UserID)
+		if comment.ReplyList == nil {
+			continue
+		}
+		for _, reply := range comment.ReplyList.Replies {
+			add(reply.UserID)
+			if reply.Content == nil {
+				continue
+			}
+			for _, e := range reply.Content.Elements {
+				if e.Person != nil {
+					add(e.Person.UserID)
+				}
+			}
+		}
+	}
+	return userIDs
+}
+
+// TodoUserIDs returns the open ids of the owners of the todos and of the
+// assignees of the tasks, to look up their names
+func TodoUserIDs(blocks []*lark.DocxBlock, tasks map[string]*DocxTask) []string {
+	seen := make(map[string]bool)
+	var userIDs []string
+	add := func(userID string) {
+		if userID != "" && !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	for _, b := range blocks {
+		switch {
+		case b.BlockType == lark.DocxBlockTypeTodo && b.Todo != nil:
+			for _, e := range b.Todo.Elements {
+				if e.MentionUser != nil {
+					add(e.MentionUser.UserID)
+				}
+			}
+		case b.BlockType == DocxBlockTypeTask && tasks[b.BlockID] != nil:
+			for _, userID := range tasks[b.BlockID].Assignees() {
+				add(userID)
+			}
+		}
+	}
+	return userIDs
+}
+
+func (p *Parser) renderCommentFootnotes(markdown string) string {
+	if len(p.comments) == 0 {
+		return markdown
+	}
+
+	// Comments on the whole document or whose quote was not found are
+	// anchored at the title
+	titleRefs := new(strings.Builder)
+	for _, comment := range p.comments {
+		if _, ok := p.commentAnchors[comment.CommentID]; !ok {
+			p.commentAnchors[comment.CommentID] = len(p.commentAnchors) + 1
+			titleRefs.WriteString(fmt.Sprintf("[^%d]", p.commentAnchors[comment.CommentID]))
+		}
+	}
+	if titleRefs.Len() > 0 {
+		title, rest, _ := strings.Cut(markdown, "\n")
+		markdown = title + titleRefs.String() + "\n" + rest
+	}
+
+	comments := make([]*DocxComment, len(p.comments))
+	copy(comments, p.comments)
+	sort.SliceStable(comments, func(i, j int) bool {
+		return p.commentAnchors[comments[i].CommentID] < p.commentAnchors[comments[j].CommentID]
+	})
+
+	buf := new(strings.Builder)
+	buf.WriteString(markdown)
+	for _, comment := range comments {
+		buf.WriteString(fmt.Sprintf("\n[^%d]: ", p.commentAnchors[comment.CommentID]))
+		buf.WriteString(strings.Join(p.renderComment(comment), "\n    "))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func (p *Parser) renderCommentAppendix() string {
+	if len(p.comments) == 0 {
+		return ""
+	}
+
+	buf := new(strings.Builder)
+	buf.WriteString("\n## Review comments\n\n")
+	for _, comment := range p.comments {
+		lines := p.renderComment(comment)
+		buf.WriteString("- " + lines[0] + "\n")
+		if !comment.IsWhole && comment.Quote != "" {
+			buf.WriteString("  > " + comment.Quote + "\n")
+		}
+		for _, line := range lines[1:] {
+			buf.WriteString("  - " + line + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// =============================================================
+// Heading anchors and table of contents
+// =============================================================
+
+type docxHeading struct {
+	level int
+	text  string
+	slug  string
+}
+
+func docxHeadingLevel(b *lark.DocxBlock) int {
+	if b.BlockType < lark.DocxBlockTypeHeading1 || b.BlockType > lark.DocxBlockTypeHeading9 {
+		return 0
+	}
+	return int(b.BlockType-lark.DocxBlockTypeHeading1) + 1
+}
+
+func docxHeadingText(b *lark.DocxBlock, headingLevel int) *lark.DocxBlockText {
+	headingText := reflect.ValueOf(b).Elem().FieldByName(fmt.Sprintf("Heading%d", headingLevel))
+	return headingText.Interface().(*lark.DocxBlockText)
+}
+
+// collectHeadings assigns the anchors of the headings in document order
+func (p *Parser) collectHeadings(b *lark.DocxBlock, slugger *utils.Slugger) {
+	for _, childId := range b.Children {
+		child, ok := p.blockMap[childId]
+		if !ok {
+			continue
+		}
+		if level := docxHeadingLevel(child); level > 0 {
+			text := new(strings.Builder)
+			if headingText := docxHeadingText(child, level); headingText != nil {
+				for _, e := range headingText.Elements {
+					text.WriteString(textElementPlainText(e))
+				}
+			}
+			// the markdown is formatted with auto spacing afterwards, which
+			// also changes the heading text the anchor is generated from
+			heading := &docxHeading{level: level, text: render.Space0(strings.TrimSpace(text.String()))}
+			heading.slug = slugger.Slug(heading.text)
+			p.headings = append(p.headings, heading)
+			p.HeadingSlugs[child.BlockID] = heading.slug
+		}
+		p.collectHeadings(child, slugger)
+	}
+}
+
+func (p *Parser) renderTOC() string {
+	minLevel := p.headings[0].level
+	for _, h := range p.headings {
+		if h.level < minLevel {
+			minLevel = h.level
+		}
+	}
+
+	escaper := strings.NewReplacer("[", "\\[", "]", "\\]")
+	buf := new(strings.Builder)
+	for _, h := range p.headings {
+		buf.WriteString(strings.Repeat("\t", h.level-minLevel))
+		buf.WriteString(fmt.Sprintf("- [%s](#%s)\n", escaper.Replace(h.text), h.slug))
+	}
+	return buf.String()
+}
+
+// resolveLink rewrites a link to a Feishu block anchor into the local heading
+// anchor when the block is a heading of this document
+func (p *Parser) resolveLink(link string) string {
+	link = utils.UnescapeURL(link)
+	if idx := strings.LastIndex(link, "#"); idx >= 0 {
+		blockID := strings.TrimPrefix(link[idx+1:], "share-")
+		if slug, ok := p.HeadingSlugs[blockID]; ok {
+			return "#" + slug
+		}
+	}
+	return link
+}
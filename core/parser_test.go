@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/88250/lute"
 	"github.com/Wsine/feishu2md/core"
@@ -32,10 +33,7 @@ func TestParseDocxContent(t *testing.T) {
 			utils.CheckErr(err)
 			defer jsonFile.Close()
 
-			data := struct {
-				Document *lark.DocxDocument `json:"document"`
-				Blocks   []*lark.DocxBlock  `json:"blocks"`
-			}{}
+			data := core.DocxDump{}
 			byteValue, _ := io.ReadAll(jsonFile)
 			json.Unmarshal(byteValue, &data)
 
@@ -52,3 +50,285 @@ func TestParseDocxContent(t *testing.T) {
 		})
 	}
 }
+
+// newTestDocx builds a document whose page block holds the given blocks
+func newTestDocx(title string, children ...*lark.DocxBlock) (*lark.DocxDocument, []*lark.DocxBlock) {
+	page := &lark.DocxBlock{
+		BlockID:   "doc",
+		BlockType: lark.DocxBlockTypePage,
+		Page: &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+			{TextRun: &lark.DocxTextElementTextRun{Content: title}},
+		}},
+	}
+	blocks := []*lark.DocxBlock{page}
+	for _, child := range children {
+		child.ParentID = page.BlockID
+		page.Children = append(page.Children, child.BlockID)
+		blocks = append(blocks, child)
+	}
+	return &lark.DocxDocument{DocumentID: page.BlockID, Title: title}, blocks
+}
+
+func newTestText(elements ...string) *lark.DocxBlockText {
+	text := &lark.DocxBlockText{}
+	for _, e := range elements {
+		text.Elements = append(text.Elements, &lark.DocxTextElement{
+			TextRun: &lark.DocxTextElementTextRun{Content: e},
+		})
+	}
+	return text
+}
+
+func TestParseDocxCodeLanguage(t *testing.T) {
+	codeBlock := func(lang lark.DocxCodeLanguage) string {
+		code := newTestText("echo hi")
+		code.Style = &lark.DocxTextStyle{Language: lang}
+		doc, blocks := newTestDocx("Code", &lark.DocxBlock{
+			BlockID:   "code",
+			BlockType: lark.DocxBlockTypeCode,
+			Code:      code,
+		})
+		config := core.NewConfig("", "").Output
+		config.CodeLanguageMap = map[string]string{"shell": "console", "76": "zig"}
+		return core.NewParser(config).ParseDocxContent(doc, blocks)
+	}
+
+	tests := []struct {
+		name string
+		lang lark.DocxCodeLanguage
+		want string
+	}{
+		{"default mapping", lark.DocxCodeLanguageGo, "```go\n"},
+		{"enum missing from the sdk", core.DocxCodeLanguageTOML, "```toml\n"},
+		{"override by name", lark.DocxCodeLanguageShell, "```console\n"},
+		{"addition by enum", lark.DocxCodeLanguage(76), "```zig\n"},
+		{"unknown enum", lark.DocxCodeLanguage(999), "```\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, codeBlock(tt.lang), tt.want)
+		})
+	}
+}
+
+func TestParseDocxComments(t *testing.T) {
+	newComment := func(id, quote string, whole, solved bool, replies ...string) *core.DocxComment {
+		c := &core.DocxComment{IsWhole: whole, Quote: quote}
+		c.CommentID = id
+		c.UserID = "ou_" + id
+		c.IsSolved = solved
+		c.ReplyList = &lark.GetDriveCommentListRespItemReplyList{}
+		for i, text := range replies {
+			c.ReplyList.Replies = append(c.ReplyList.Replies, &lark.GetDriveCommentListRespItemReplyListReply{
+				UserID:     fmt.Sprintf("ou_%s%d", id, i),
+				CreateTime: 1700000000,
+				Content: &lark.GetDriveCommentListRespItemReplyListReplyContent{
+					Elements: []*lark.GetDriveCommentListRespItemReplyListReplyContentElement{
+						{Type: "text_run", TextRun: &lark.GetDriveCommentListRespItemReplyListReplyContentElementTextRun{Text: text}},
+					},
+				},
+			})
+		}
+		return c
+	}
+	comments := []*core.DocxComment{
+		newComment("a", "fox jumps", false, true, "Is it a fox?", "Yes"),
+		newComment("b", "", true, false, "Looks good"),
+	}
+	parse := func(style string) string {
+		doc, blocks := newTestDocx("Title", &lark.DocxBlock{
+			BlockID:   "text",
+			BlockType: lark.DocxBlockTypeText,
+			Text:      newTestText("The quick brown ", "fox jumps", " over the lazy dog"),
+		})
+		config := core.NewConfig("", "").Output
+		config.CommentStyle = style
+		parser := core.NewParser(config)
+		parser.SetComments(comments)
+		return parser.ParseDocxContent(doc, blocks)
+	}
+	created := time.Unix(1700000000, 0).Format("2006-01-02 15:04")
+
+	t.Run("footnote", func(t *testing.T) {
+		md := parse(core.CommentStyleFootnote)
+		assert.Contains(t, md, "# Title[^2]\n")
+		assert.Contains(t, md, "The quick brown fox jumps[^1] over the lazy dog")
+		assert.Contains(t, md, fmt.Sprintf("[^1]: **ou_a0** %s (resolved): Is it a fox?\n    **ou_a1** %s: Yes\n", created, created))
+		assert.Contains(t, md, fmt.Sprintf("[^2]: **ou_b0** %s (unresolved): Looks good\n", created))
+	})
+	t.Run("appendix", func(t *testing.T) {
+		md := parse(core.CommentStyleAppendix)
+		assert.NotContains(t, md, "[^")
+		assert.Contains(t, md, fmt.Sprintf(
+			"## Review comments\n\n- **ou_a0** %s (resolved): Is it a fox?\n  > fox jumps\n  - **ou_a1** %s: Yes\n- **ou_b0** %s (unresolved): Looks good\n",
+			created, created, created))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		md := parse("")
+		assert.NotContains(t, md, "[^")
+		assert.NotContains(t, md, "Review comments")
+	})
+	t.Run("heading", func(t *testing.T) {
+		doc, blocks := newTestDocx("Title", &lark.DocxBlock{
+			BlockID:   "h1",
+			BlockType: lark.DocxBlockTypeHeading2,
+			Heading2:  newTestText("Getting Started"),
+		})
+		config := core.NewConfig("", "").Output
+		config.CommentStyle = core.CommentStyleFootnote
+		config.TOC = true
+		parser := core.NewParser(config)
+		parser.SetComments([]*core.DocxComment{newComment("c", "Started", false, false, "Typo")})
+		md := parser.ParseDocxContent(doc, blocks)
+		// the footnote ref stays out of the heading and its anchor
+		assert.Contains(t, md, "## Getting Started\n\n[^1]\n")
+		assert.Contains(t, md, "- [Getting Started](#getting-started)\n")
+		assert.Equal(t, "getting-started", parser.HeadingSlugs["h1"])
+	})
+	t.Run("user names", func(t *testing.T) {
+		assert.Equal(t, []string{"ou_a", "ou_a0", "ou_a1", "ou_b", "ou_b0"}, core.CommentUserIDs(comments))
+		doc, blocks := newTestDocx("Title")
+		config := core.NewConfig("", "").Output
+		config.CommentStyle = core.CommentStyleAppendix
+		parser := core.NewParser(config)
+		parser.SetComments(comments)
+		parser.SetUserNames(map[string]string{"ou_a0": "Alice"})
+		md := parser.ParseDocxContent(doc, blocks)
+		assert.Contains(t, md, fmt.Sprintf("- **Alice** %s (resolved): Is it a fox?\n", created))
+		assert.Contains(t, md, fmt.Sprintf("  - **ou_a1** %s: Yes\n", created))
+	})
+	t.Run("anonymous", func(t *testing.T) {
+		anonymous := newComment("c", "", true, false, "Who am I?")
+		anonymous.ReplyList.Replies[0].UserID = ""
+		doc, blocks := newTestDocx("Title")
+		config := core.NewConfig("", "").Output
+		config.CommentStyle = core.CommentStyleFootnote
+		parser := core.NewParser(config)
+		parser.SetComments([]*core.DocxComment{anonymous})
+		md := parser.ParseDocxContent(doc, blocks)
+		assert.NotContains(t, md, "****")
+		assert.Contains(t, md, fmt.Sprintf("[^1]: %s (unresolved): Who am I?\n", created))
+	})
+	t.Run("code block", func(t *testing.T) {
+		doc, blocks := newTestDocx("Title", &lark.DocxBlock{
+			BlockID:   "code",
+			BlockType: lark.DocxBlockTypeCode,
+			Code:      newTestText("fmt.Println(\"fox jumps\")"),
+		})
+		blocks[1].Code.Style = &lark.DocxTextStyle{Language: lark.DocxCodeLanguageGo}
+		config := core.NewConfig("", "").Output
+		config.CommentStyle = core.CommentStyleFootnote
+		parser := core.NewParser(config)
+		parser.SetComments(comments[:1])
+		md := parser.ParseDocxContent(doc, blocks)
+		assert.Contains(t, md, "```go\nfmt.Println(\"fox jumps\")\n```\n[^1]\n")
+	})
+}
+
+func TestParseDocxEquation(t *testing.T) {
+	parse := func(dialect string) string {
+		// a paragraph holding only a formula is still inline
+		inline := &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+			{Equation: &lark.DocxTextElementEquation{Content: "a<b\n"}},
+		}}
+		display := &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+			{Equation: &lark.DocxTextElementEquation{Content: "E=mc^2"}},
+		}}
+		doc, blocks := newTestDocx("Math",
+			&lark.DocxBlock{BlockID: "text", BlockType: lark.DocxBlockTypeText, Text: inline},
+			&lark.DocxBlock{BlockID: "equation", BlockType: lark.DocxBlockTypeEquation, Equation: display},
+		)
+		config := core.NewConfig("", "").Output
+		config.MathDialect = dialect
+		return core.NewParser(config).ParseDocxContent(doc, blocks)
+	}
+
+	tests := []struct {
+		dialect string
+		inline  string
+		display string
+	}{
+		{core.MathDialectDollar, "$a<b$\n", "$$\nE=mc^2\n$$\n"},
+		{core.MathDialectLaTeX, "\\(a<b\\)\n", "\\[\nE=mc^2\n\\]\n"},
+		{core.MathDialectGitLab, "$`a<b`$\n", "```math\nE=mc^2\n```\n"},
+		{
+			core.MathDialectMathML,
+			`<math display="inline"><semantics><mtext>a&lt;b</mtext><annotation encoding="application/x-tex">a&lt;b</annotation></semantics></math>`,
+			`<math display="block"><semantics><mtext>E=mc^2</mtext><annotation encoding="application/x-tex">E=mc^2</annotation></semantics></math>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			md := parse(tt.dialect)
+			assert.Contains(t, md, tt.inline)
+			assert.Contains(t, md, tt.display)
+		})
+	}
+}
+
+func TestParseDocxTodo(t *testing.T) {
+	due := time.Date(2024, 3, 8, 10, 0, 0, 0, time.Local)
+	todo := &lark.DocxBlockText{
+		Style: &lark.DocxTextStyle{Done: false},
+		Elements: []*lark.DocxTextElement{
+			{TextRun: &lark.DocxTextElementTextRun{Content: "Send the minutes "}},
+			{MentionUser: &lark.DocxTextElementMentionUser{UserID: "ou_alice"}},
+			{Reminder: &lark.DocxTextElementReminder{ExpireTime: fmt.Sprint(due.UnixMilli())}},
+		},
+	}
+	done := newTestText("Book the room")
+	done.Style = &lark.DocxTextStyle{Done: true}
+	doc, blocks := newTestDocx("Meeting",
+		&lark.DocxBlock{BlockID: "todo", BlockType: lark.DocxBlockTypeTodo, Todo: todo},
+		&lark.DocxBlock{BlockID: "done", BlockType: lark.DocxBlockTypeTodo, Todo: done},
+		&lark.DocxBlock{BlockID: "task", BlockType: core.DocxBlockTypeTask},
+		&lark.DocxBlock{BlockID: "unknown", BlockType: core.DocxBlockTypeTask},
+	)
+
+	parser := core.NewParser(core.NewConfig("", "").Output)
+	tasks := map[string]*core.DocxTask{
+		"task": {GUID: "guid", Summary: "Ship the release", CompletedAt: "1709856000000",
+			Due: &core.DocxTaskDue{Timestamp: "1709856000000", IsAllDay: true},
+			Members: []*core.DocxTaskMember{
+				{ID: "ou_bob", Role: "assignee"},
+				{ID: "ou_carol", Role: "follower"},
+			}},
+	}
+	parser.SetTasks(tasks)
+	assert.Equal(t, []string{"ou_alice", "ou_bob"}, core.TodoUserIDs(blocks, tasks))
+	// the open id is kept without a name
+	parser.SetUserNames(map[string]string{"ou_bob": "Bob"})
+	md := parser.ParseDocxContent(doc, blocks)
+	assert.Contains(t, md, "- [ ] Send the minutes @ou_alice 📅 2024-03-08\n")
+	assert.Contains(t, md, "- [x] Book the room\n")
+	assert.Contains(t, md, "- [x] Ship the release @Bob 📅 2024-03-08\n")
+	// the task could not be read
+	assert.Contains(t, md, "<!-- Feishu task not exported, see the original document -->\n")
+	assert.Equal(t, []*core.TodoItem{
+		{Text: "Send the minutes", Owners: []string{"ou_alice"}, Due: "2024-03-08"},
+		{Text: "Book the room", Done: true},
+		{Text: "Ship the release", Done: true, Owners: []string{"Bob"}, Due: "2024-03-08"},
+	}, parser.Todos)
+}
+
+func TestParseDocxTOC(t *testing.T) {
+	link := newTestText("see setup")
+	link.Elements[0].TextRun.TextElementStyle = &lark.DocxTextElementStyle{
+		Link: &lark.DocxTextElementStyleLink{URL: "https%3A%2F%2Fsample.feishu.cn%2Fdocx%2Fdoc%23h2"},
+	}
+	doc, blocks := newTestDocx("Guide",
+		&lark.DocxBlock{BlockID: "h1", BlockType: lark.DocxBlockTypeHeading1, Heading1: newTestText("Getting Started")},
+		&lark.DocxBlock{BlockID: "h2", BlockType: lark.DocxBlockTypeHeading2, Heading2: newTestText("Setup")},
+		&lark.DocxBlock{BlockID: "h3", BlockType: lark.DocxBlockTypeHeading2, Heading2: newTestText("Setup")},
+		&lark.DocxBlock{BlockID: "h4", BlockType: lark.DocxBlockTypeHeading2, Heading2: newTestText("使用Feishu2Md工具")},
+		&lark.DocxBlock{BlockID: "text", BlockType: lark.DocxBlockTypeText, Text: link},
+	)
+
+	config := core.NewConfig("", "").Output
+	config.TOC = true
+	parser := core.NewParser(config)
+	md := parser.ParseDocxContent(doc, blocks)
+	assert.Contains(t, md, "# Guide\n\n- [Getting Started](#getting-started)\n\t- [Setup](#setup)\n\t- [Setup](#setup-1)\n\t- [使用 Feishu2Md 工具](#使用-feishu2md-工具)\n\n")
+	assert.Contains(t, md, "[see setup](#setup)")
+	assert.Equal(t, "setup-1", parser.HeadingSlugs["h3"])
+}
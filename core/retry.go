@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chyroc/lark"
+)
+
+// RetryPolicy is how the failed requests are retried. The delay before the
+// n-th retry is a random duration in [d/2, d] with d = BaseDelay * 2^n
+// capped by MaxDelay, unless the rate limit headers ask for a longer wait.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// WithRetryPolicy replaces the default policy to retry the transient errors
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+func (p RetryPolicy) delay(attempt int, resp *lark.Response) time.Duration {
+	d := p.BaseDelay << attempt
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if d > 0 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	if wait := rateLimitWait(resp); wait > d {
+		d = wait
+	}
+	return d
+}
+
+// rateLimitWait returns the wait asked by the rate limit headers of resp
+func rateLimitWait(resp *lark.Response) time.Duration {
+	if resp == nil || resp.Header == nil {
+		return 0
+	}
+	for _, header := range []string{"x-ogw-ratelimit-reset", "Retry-After"} {
+		if seconds, err := strconv.Atoi(resp.Header.Get(header)); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 0
+}
+
+// nonIdempotentAPIs create a resource by each request. A server error may
+// come after the resource is created, so they are only retried when the
+// rate limit rejected the request before it was processed.
+var nonIdempotentAPIs = map[string]bool{
+	"CreateDriveExportTask": true,
+}
+
+func retryable(req *lark.RawRequestReq, e *APIError) bool {
+	if e.Kind == ErrRateLimited {
+		return true
+	}
+	if nonIdempotentAPIs[req.API] {
+		return false
+	}
+	if e.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	// network errors have no response
+	return e.StatusCode == 0 && e.Code == 0 && !errors.Is(e.Err, ErrNotRecorded) &&
+		!errors.Is(e.Err, context.Canceled) && !errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// retryMiddleware retries the transient errors of the requests and turns
+// the errors into APIError.
+func retryMiddleware(policy RetryPolicy) lark.ApiMiddleware {
+	return func(next lark.ApiEndpoint) lark.ApiEndpoint {
+		return func(ctx context.Context, req *lark.RawRequestReq, resp interface{}) (*lark.Response, error) {
+			for attempt := 0; ; attempt++ {
+				response, err := next(ctx, req, resp)
+				if err == nil {
+					return response, nil
+				}
+				var apiErr *APIError
+				if errors.As(err, &apiErr) {
+					// failed in a nested request, e.g. the access token,
+					// which has been retried already
+					return response, err
+				}
+				apiErr = newAPIError(req, response, err)
+				if attempt >= policy.MaxRetries || !retryable(req, apiErr) {
+					return response, apiErr
+				}
+				timer := time.NewTimer(policy.delay(attempt, response))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return response, apiErr
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
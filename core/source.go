@@ -0,0 +1,42 @@
+package core
+
+import (
+	"context"
+
+	"github.com/chyroc/lark"
+)
+
+// DocSource provides the documents to export. It is implemented by Client
+// for the Feishu Open API and by MemorySource for offline use.
+type DocSource interface {
+	DownloadImage(ctx context.Context, imgToken, outDir string) (string, error)
+	DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error)
+	GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error)
+	GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error)
+	GetDocxBlocks(ctx context.Context, documentID string) ([]*lark.DocxBlock, error)
+	GetDocxComments(ctx context.Context, docToken string) ([]*DocxComment, error)
+	GetDocxTask(ctx context.Context, docToken, blockID string) (*DocxTask, error)
+	GetUserName(ctx context.Context, userID string) (string, error)
+	GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error)
+	GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error)
+	GetDriveFileMetas(ctx context.Context, docs []*lark.GetDriveFileMetaReqRequestDocs) ([]*lark.GetDriveFileMetaRespMeta, error)
+	GetWikiName(ctx context.Context, spaceID string) (string, error)
+	GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*lark.GetWikiNodeListRespItem, error)
+	GetSheets(ctx context.Context, spreadsheetToken string) ([]*Sheet, error)
+	GetBitableTables(ctx context.Context, appToken string) ([]*BitableTable, error)
+	ExportFile(ctx context.Context, token, objType, ext string) (string, []byte, error)
+	DownloadFile(ctx context.Context, fileToken string) (string, []byte, error)
+}
+
+var _ DocSource = (*Client)(nil)
+
+// DocxDump is the json format of a document written by `download --dump`,
+// with the comments when comment_style is set, the tasks of the task blocks
+// by block id and the names of the comment authors and todo owners
+type DocxDump struct {
+	Document  *lark.DocxDocument   `json:"document"`
+	Blocks    []*lark.DocxBlock    `json:"blocks"`
+	Comments  []*DocxComment       `json:"comments,omitempty"`
+	UserNames map[string]string    `json:"user_names,omitempty"`
+	Tasks     map[string]*DocxTask `json:"tasks,omitempty"`
+}
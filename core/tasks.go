@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// DocxTask is the Feishu task of a task block, read with the task v2 API
+type DocxTask struct {
+	GUID        string            `json:"guid"`
+	Summary     string            `json:"summary"`
+	CompletedAt string            `json:"completed_at,omitempty"`
+	Due         *DocxTaskDue      `json:"due,omitempty"`
+	Members     []*DocxTaskMember `json:"members,omitempty"`
+}
+
+// DocxTaskDue is the due time of a task in milliseconds
+type DocxTaskDue struct {
+	Timestamp string `json:"timestamp"`
+	IsAllDay  bool   `json:"is_all_day,omitempty"`
+}
+
+// DocxTaskMember is an assignee or a follower of a task
+type DocxTaskMember struct {
+	ID   string `json:"id"`
+	Type string `json:"type,omitempty"`
+	Role string `json:"role"`
+}
+
+// Done tells whether the task is completed, the API returns "0" otherwise
+func (t *DocxTask) Done() bool {
+	return t.CompletedAt != "" && t.CompletedAt != "0"
+}
+
+// Assignees returns the open ids of the assignees
+func (t *DocxTask) Assignees() []string {
+	var userIDs []string
+	for _, m := range t.Members {
+		if m.Role == "assignee" && m.ID != "" {
+			userIDs = append(userIDs, m.ID)
+		}
+	}
+	return userIDs
+}
+
+// DueDate returns the due date like 2024-03-08, or "" without a due time.
+// An all day due time is the midnight in UTC of the date.
+func (t *DocxTask) DueDate() string {
+	if t.Due == nil {
+		return ""
+	}
+	ms, err := strconv.ParseInt(t.Due.Timestamp, 10, 64)
+	if err != nil || ms == 0 {
+		return ""
+	}
+	due := time.UnixMilli(ms)
+	if t.Due.IsAllDay {
+		due = due.UTC()
+	}
+	return due.Format("2006-01-02")
+}
+
+// TaskBlockIDs returns the ids of the task blocks, to look up their tasks
+func TaskBlockIDs(blocks []*lark.DocxBlock) []string {
+	var blockIDs []string
+	for _, b := range blocks {
+		if b.BlockType == DocxBlockTypeTask {
+			blockIDs = append(blockIDs, b.BlockID)
+		}
+	}
+	return blockIDs
+}
+
+// GetDocxTask gets the task of a task block. The sdk decodes the block
+// without its task id, so the block is read again before the task.
+func (c *Client) GetDocxTask(ctx context.Context, docToken, blockID string) (*DocxTask, error) {
+	type blockReq struct {
+		DocumentID string `path:"document_id" json:"-"`
+		BlockID    string `path:"block_id" json:"-"`
+	}
+	type blockResp struct {
+		Code int64  `json:"code,omitempty"`
+		Msg  string `json:"msg,omitempty"`
+		Data *struct {
+			Block *struct {
+				Task *struct {
+					TaskID string `json:"task_id"`
+				} `json:"task,omitempty"`
+			} `json:"block,omitempty"`
+		} `json:"data,omitempty"`
+	}
+	type taskReq struct {
+		TaskGUID   string `path:"task_guid" json:"-"`
+		UserIDType string `query:"user_id_type" json:"-"`
+	}
+	type taskResp struct {
+		Code int64  `json:"code,omitempty"`
+		Msg  string `json:"msg,omitempty"`
+		Data *struct {
+			Task *DocxTask `json:"task,omitempty"`
+		} `json:"data,omitempty"`
+	}
+
+	opts, err := c.methodOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	methodOption := &lark.MethodOption{}
+	for _, opt := range opts {
+		opt(methodOption)
+	}
+
+	block := new(blockResp)
+	_, err = c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+		Scope:                 "Docx",
+		API:                   "GetDocxBlock",
+		Method:                "GET",
+		URL:                   c.openBaseURL + "/open-apis/docx/v1/documents/:document_id/blocks/:block_id",
+		Body:                  &blockReq{DocumentID: docToken, BlockID: blockID},
+		MethodOption:          methodOption,
+		NeedTenantAccessToken: true,
+		NeedUserAccessToken:   c.userToken != nil,
+	}, block)
+	if err != nil {
+		return nil, err
+	}
+	if block.Data == nil || block.Data.Block == nil || block.Data.Block.Task == nil || block.Data.Block.Task.TaskID == "" {
+		return nil, errors.Errorf("no task found in block %s", blockID)
+	}
+
+	task := new(taskResp)
+	_, err = c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+		Scope:                 "Task",
+		API:                   "GetTaskV2",
+		Method:                "GET",
+		URL:                   c.openBaseURL + "/open-apis/task/v2/tasks/:task_guid",
+		Body:                  &taskReq{TaskGUID: block.Data.Block.Task.TaskID, UserIDType: "open_id"},
+		MethodOption:          methodOption,
+		NeedTenantAccessToken: true,
+		NeedUserAccessToken:   c.userToken != nil,
+	}, task)
+	if err != nil {
+		return nil, err
+	}
+	if task.Data == nil || task.Data.Task == nil {
+		return nil, errors.Errorf("task %s not found", block.Data.Block.Task.TaskID)
+	}
+	return task.Data.Task, nil
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"unicode/utf8"
 )
 
 var StopWhenErr = true
@@ -30,10 +32,59 @@ func PrettyPrint(i interface{}) string {
 	return string(s)
 }
 
+// MaxFileNameBytes leaves room below the 255 bytes limit of the common
+// file systems for a de-duplication suffix
+const MaxFileNameBytes = 240
+
+// windowsReservedNames are the device names Windows forbids as file names,
+// with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName makes a title a valid file or directory name on all
+// platforms: the invalid and control characters are replaced by _, the
+// trailing dots and spaces are trimmed, the reserved names of Windows are
+// prefixed by _ and the name is cut to MaxFileNameBytes keeping its
+// extension.
 func SanitizeFileName(title string) string {
 	invalidChars := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
 	for _, char := range invalidChars {
 		title = strings.ReplaceAll(title, char, "_")
 	}
+	title = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, title)
+	title = strings.TrimRight(strings.TrimSpace(title), ". ")
+	if title == "" {
+		return "_"
+	}
+	stem := title
+	if i := strings.Index(title, "."); i >= 0 {
+		stem = title[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(stem))] {
+		title = "_" + title
+	}
+
+	if len(title) > MaxFileNameBytes {
+		ext := filepath.Ext(title)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		stem := title[:len(title)-len(ext)]
+		cut := MaxFileNameBytes - len(ext)
+		for cut > 0 && !utf8.RuneStart(stem[cut]) {
+			cut--
+		}
+		title = strings.TrimRight(stem[:cut], ". ") + ext
+	}
 	return title
 }
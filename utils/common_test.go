@@ -2,7 +2,9 @@ package utils_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/Wsine/feishu2md/utils"
 )
@@ -17,3 +19,29 @@ func TestCheckErr(t *testing.T) {
 	err := errors.New("This is an error message.")
 	utils.CheckErr(err)
 }
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Install / Upgrade: FAQ?", "Install _ Upgrade_ FAQ_"},
+		{"Line\tbreak", "Line_break"},
+		{"Version 1.0. ", "Version 1.0"},
+		{"...", "_"},
+		{"", "_"},
+		{"con", "_con"},
+		{"LPT1.md", "_LPT1.md"},
+		{"Console", "Console"},
+	}
+	for _, tt := range tests {
+		if got := utils.SanitizeFileName(tt.title); got != tt.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+
+	long := utils.SanitizeFileName(strings.Repeat("文档", 100) + ".md")
+	if len(long) > utils.MaxFileNameBytes || !strings.HasSuffix(long, ".md") || !utf8.ValidString(long) {
+		t.Errorf("SanitizeFileName cut a long title to %q", long)
+	}
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+const (
+	SlugStyleGitHub     = "github"
+	SlugStyleGitLab     = "gitlab"
+	SlugStyleHugo       = "hugo"
+	SlugStyleDocusaurus = "docusaurus"
+)
+
+// Slugify converts a heading text to its anchor following the rules of the
+// given markdown renderer. Hugo and Docusaurus both follow the GitHub rules,
+// while GitLab additionally collapses consecutive hyphens.
+func Slugify(text, style string) string {
+	buf := new(strings.Builder)
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsNumber(r), unicode.IsMark(r), r == '_', r == '-':
+			buf.WriteRune(r)
+		case r == ' ':
+			buf.WriteRune('-')
+		}
+	}
+	slug := buf.String()
+	if style == SlugStyleGitLab {
+		for strings.Contains(slug, "--") {
+			slug = strings.ReplaceAll(slug, "--", "-")
+		}
+	}
+	return slug
+}
+
+// Slugger generates unique anchors within a document by appending -1, -2...
+// to repeated slugs like the supported renderers do.
+type Slugger struct {
+	style string
+	seen  map[string]bool
+}
+
+func NewSlugger(style string) *Slugger {
+	return &Slugger{style: style, seen: make(map[string]bool)}
+}
+
+func (s *Slugger) Slug(text string) string {
+	base := Slugify(text, s.style)
+	slug := base
+	for i := 1; s.seen[slug]; i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	s.seen[slug] = true
+	return slug
+}
+
+// Pinyin transliterates the Chinese characters of a text to pinyin without
+// tones, separated from each other and from the rest of the text by
+// hyphens, e.g. 发布说明 v2 to fa-bu-shuo-ming-v2 once slugified.
+func Pinyin(text string) string {
+	args := pinyin.NewArgs()
+	buf := new(strings.Builder)
+	han := false
+	for _, r := range text {
+		py := pinyin.SinglePinyin(r, args)
+		if len(py) == 0 || !unicode.Is(unicode.Han, r) {
+			if han && !unicode.IsSpace(r) && r != '-' {
+				buf.WriteRune('-')
+			}
+			buf.WriteRune(r)
+			han = false
+			continue
+		}
+		if buf.Len() > 0 {
+			last, _ := utf8.DecodeLastRuneInString(buf.String())
+			if !unicode.IsSpace(last) && last != '-' {
+				buf.WriteRune('-')
+			}
+		}
+		buf.WriteString(py[0])
+		han = true
+	}
+	return buf.String()
+}
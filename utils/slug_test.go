@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		style string
+		want  string
+	}{
+		{
+			name:  "github keeps repeated hyphens",
+			text:  "Step 1 - Install (macOS)",
+			style: SlugStyleGitHub,
+			want:  "step-1---install-macos",
+		},
+		{
+			name:  "gitlab collapses hyphens",
+			text:  "Step 1 - Install (macOS)",
+			style: SlugStyleGitLab,
+			want:  "step-1-install-macos",
+		},
+		{
+			name:  "unicode letters are kept",
+			text:  "使用 Feishu2Md 工具",
+			style: SlugStyleHugo,
+			want:  "使用-feishu2md-工具",
+		},
+		{
+			name:  "punctuation is dropped",
+			text:  "What's new?",
+			style: SlugStyleDocusaurus,
+			want:  "whats-new",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Slugify(tt.text, tt.style); got != tt.want {
+				t.Errorf("Slugify(%v, %v) = %v, want %v", tt.text, tt.style, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlugger(t *testing.T) {
+	s := NewSlugger(SlugStyleGitHub)
+	for _, want := range []string{"intro", "intro-1", "intro-2"} {
+		if got := s.Slug("Intro"); got != want {
+			t.Errorf("Slug(Intro) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPinyin(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"发布说明", "fa-bu-shuo-ming"},
+		{"发布说明 v2", "fa-bu-shuo-ming v2"},
+		{"v2发布", "v2-fa-bu"},
+		{"Release Notes", "Release Notes"},
+	}
+	for _, tt := range tests {
+		if got := Pinyin(tt.text); got != tt.want {
+			t.Errorf("Pinyin(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got := Slugify(Pinyin("发布说明 v2"), SlugStyleGitHub); got != "fa-bu-shuo-ming-v2" {
+		t.Errorf("Slugify(Pinyin()) = %q", got)
+	}
+}
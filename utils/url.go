@@ -46,3 +46,14 @@ func ValidateWikiURL(url string) (string, string, error) {
 	wikiToken := matchResult[2]
 	return prefixURL, wikiToken, nil
 }
+
+func ValidateWikiNodeURL(url string) (string, string, error) {
+	reg := regexp.MustCompile(`^(https://[\w-.]+)/wiki/([a-zA-Z0-9]+)`)
+	matchResult := reg.FindStringSubmatch(url)
+	if matchResult == nil || len(matchResult) != 3 || matchResult[2] == "settings" {
+		return "", "", errors.Errorf("Invalid feishu/larksuite wiki node URL pattern")
+	}
+	prefixURL := matchResult[1]
+	nodeToken := matchResult[2]
+	return prefixURL, nodeToken, nil
+}
@@ -121,3 +121,42 @@ func TestValidWikiURL(t *testing.T) {
 		})
 	}
 }
+
+func TestValidWikiNodeURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		prefix string
+		token  string
+		noErr  bool
+	}{
+		{
+			name:   "validate wiki settings failed",
+			url:    "https://sample.feishu.cn/wiki/settings/7100000000000000001",
+			prefix: "",
+			token:  "",
+			noErr:  false,
+		},
+		{
+			name:   "validate docx url failed",
+			url:    "https://sample.feishu.cn/docx/doccnByZP6puODElAYySJkPIfUb",
+			prefix: "",
+			token:  "",
+			noErr:  false,
+		},
+		{
+			name:   "validate larksuite wiki node success",
+			url:    "https://sample.sg.larksuite.com/wiki/wikcnByZP6puODElAYySJkPIfUb?from=from_copylink",
+			prefix: "https://sample.sg.larksuite.com",
+			token:  "wikcnByZP6puODElAYySJkPIfUb",
+			noErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if prefix, token, got := ValidateWikiNodeURL(tt.url); (got == nil) != tt.noErr || prefix != tt.prefix || token != tt.token {
+				t.Errorf("ValidateWikiNodeURL(%v) = %v, %v; want prefix = %v, want token = %v", tt.url, prefix, token, tt.prefix, tt.token)
+			}
+		})
+	}
+}
@@ -17,6 +17,55 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// docSources are the clients of the open platforms, created once when the
+// server starts so that all requests share the rate limit of the app
+type docSources struct {
+	config  *core.Config
+	sources map[string]core.DocSource
+}
+
+var webSources *docSources
+
+// newWebConfig reads the config of the server from the environment
+func newWebConfig() *core.Config {
+	config := core.NewConfig(
+		os.Getenv("FEISHU_APP_ID"),
+		os.Getenv("FEISHU_APP_SECRET"),
+	)
+	config.Feishu.ApiDomain = os.Getenv("FEISHU_API_DOMAIN")
+	config.HTTP.Proxy = os.Getenv("FEISHU_HTTP_PROXY")
+	config.HTTP.CABundle = os.Getenv("FEISHU_CA_BUNDLE")
+	return config
+}
+
+// newDocSources creates a client for each open platform the documents may
+// be on, that is Feishu and Lark unless the api domain is configured
+func newDocSources(config *core.Config) (*docSources, error) {
+	httpClient, err := core.NewHTTPClient(config.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	s := &docSources{config: config, sources: make(map[string]core.DocSource)}
+	for _, docURL := range []string{"https://feishu.cn", "https://larksuite.com"} {
+		baseURL := core.ResolveBaseURL(config.Feishu.ApiDomain, docURL)
+		if _, ok := s.sources[baseURL]; ok {
+			continue
+		}
+		s.sources[baseURL] = core.NewClient(
+			config.Feishu.AppId, config.Feishu.AppSecret,
+			core.WithBaseURL(baseURL),
+			core.WithRateLimit(config.Feishu.RateLimit, config.Feishu.RateBurst),
+			core.WithHTTPClient(httpClient),
+		)
+	}
+	return s, nil
+}
+
+// get returns the client for the document url
+func (s *docSources) get(docURL string) core.DocSource {
+	return s.sources[core.ResolveBaseURL(s.config.Feishu.ApiDomain, docURL)]
+}
+
 func downloadHandler(c *gin.Context) {
 	// get parameters
 	feishu_docx_url, err := url.QueryUnescape(c.Query("url"))
@@ -29,15 +78,10 @@ func downloadHandler(c *gin.Context) {
 	docType, docToken, err := utils.ValidateDocumentURL(feishu_docx_url)
 	fmt.Println("Captured document token:", docToken)
 
-	// Create client with context
+	// Get the shared client
 	ctx := context.Background()
-	config := core.NewConfig(
-		os.Getenv("FEISHU_APP_ID"),
-		os.Getenv("FEISHU_APP_SECRET"),
-	)
-	client := core.NewClient(
-		config.Feishu.AppId, config.Feishu.AppSecret,
-	)
+	config := webSources.config
+	client := webSources.get(feishu_docx_url)
 
 	// Process the download
 	parser := core.NewParser(config.Output)
@@ -19,6 +19,12 @@ func main() {
 		utils.LoadEnv()
 	}
 
+	sources, err := newDocSources(newWebConfig())
+	if err != nil {
+		log.Panicf("error: %s", err)
+	}
+	webSources = sources
+
 	router := gin.New()
 	templ := template.Must(template.New("").ParseFS(f, "templ/*.templ.html"))
 	router.SetHTMLTemplate(templ)